@@ -0,0 +1,542 @@
+package dynamic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"debug/buildinfo"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ZenLiuCN/fn"
+	"github.com/pkujhd/goloader"
+)
+
+type (
+	// Builder compiles go sources into object files or linkables, each build works in a private temporary directory,
+	// so a Builder is safe for concurrent builds.
+	Builder struct {
+		Dir     string // directory of sources, default the current working directory
+		Debug   bool
+		Options BuildOptions
+		Name    string // name of the artifact without extension, default derived from sources, module or layer
+		Retain  string // directory to retain intermediate files such as '.o', '.a' and 'importcfg', discarded if empty
+		Cache   *Cache // build cache, disabled if nil, artifacts are stored but never restored when Retain is set
+	}
+	// BuildOptions applies to both 'go list' and 'go tool compile' steps.
+	BuildOptions struct {
+		Tags     []string `json:"tags,omitempty"`     // build tags
+		GCFlags  []string `json:"gcflags,omitempty"`  // flags of 'go tool compile', such as '-N' and '-l' for debugging
+		TrimPath bool     `json:"trimpath,omitempty"` // remove file system paths from compiled output
+		Race     bool     `json:"race,omitempty"`     // enable data race detection
+		GOFLAGS  string   `json:"goflags,omitempty"`  // overrides GOFLAGS of environment if not empty
+		Env      []string `json:"env,omitempty"`      // extra environment variables as 'KEY=VALUE'
+		Overlay  string   `json:"overlay,omitempty"`  // overlay file of 'go list', such as prepared by [SDK.Prepare]
+	}
+	// PackOptions controls which dependency packages are packed into a linkable.
+	PackOptions struct {
+		NoPkg    bool     // pack without dependencies
+		Includes []string // pack dependency packages only included, if provided Excludes will no effect
+		Excludes []string // pack dependency packages excluded
+		// Host is the path of host executable, if provided only packages not linked into the host are packed, and
+		// Includes and Excludes will no effect. The host must be built by the same go version.
+		Host string
+		// Layers are linkables of shared dependencies, packages they provide are not packed, and recorded as
+		// [BuildResult.Requires].
+		Layers []string
+	}
+	// BuildResult is the artifact and diagnostics of a build.
+	BuildResult struct {
+		Name        string   // file name of the artifact, such as 'main.o', 'main.a' or 'main.linkable'
+		Data        []byte   // content of the artifact
+		Missing     []string // symbols required from the host, only for linkable
+		Requires    []string // layers required, see [WriteManifest]
+		Hash        string   // hex encoded sha256 of Data, builds of same sources and options are identical
+		Cached      bool     // restored from [Builder.Cache]
+		Diagnostics []Diagnostic
+		step        string // running step
+	}
+	// Diagnostic is a message reported by a build step.
+	Diagnostic struct {
+		Step    string // list, compile or pack
+		File    string // empty when the message is not positioned
+		Line    int
+		Column  int
+		Message string
+	}
+)
+
+// ErrBuild occurs when a build step fails, see [BuildResult.Diagnostics] for details.
+var ErrBuild = errors.New("build failed")
+
+// hostPackages must be provided by the host, they hold runtime states.
+var hostPackages = []string{
+	"runtime",
+	"internal",
+	"unsafe",
+	"vendor",
+	"syscall",
+	"reflect",
+	"sync",
+	"os",
+	"github.com/pkujhd/goloader",
+	"github.com/ZenLiuCN/dynamic",
+}
+
+var position = regexp.MustCompile(`^(.+?):(\d+)(?::(\d+))?: (.*)$`)
+
+func (d Diagnostic) String() string {
+	if d.File == "" {
+		return fmt.Sprintf("[%s] %s", d.Step, d.Message)
+	}
+	return fmt.Sprintf("[%s] %s:%d:%d: %s", d.Step, d.File, d.Line, d.Column, d.Message)
+}
+
+// Compile sources into an object file, or a go archive for many sources.
+func (b *Builder) Compile(ctx context.Context, sources []string) (r *BuildResult, err error) {
+	r = new(BuildResult)
+	err = b.build(r, func(tmp string) (err error) {
+		var cfg []byte
+		if cfg, err = b.importcfg(ctx, r, sources); err != nil {
+			return
+		}
+		var key string
+		if key, err = b.key(ctx, r, "compile", cfg, sources, PackOptions{}); err != nil || b.restore(key, r) {
+			return
+		}
+		var file string
+		if file, err = b.compile(ctx, r, tmp, sources, cfg, false); err != nil {
+			return
+		}
+		r.Name = b.name(strings.TrimSuffix(filepath.Base(sources[0]), ".go"), filepath.Ext(file))
+		if r.Data, err = os.ReadFile(file); err == nil {
+			b.store(key, r)
+		}
+		return
+	})
+	return
+}
+
+// Pack compile sources as package pkgPath and pack with its dependencies into a linkable.
+func (b *Builder) Pack(ctx context.Context, sources []string, pkgPath string, opt PackOptions) (r *BuildResult, err error) {
+	r = new(BuildResult)
+	err = b.build(r, func(tmp string) (err error) {
+		var cfg []byte
+		if cfg, err = b.importcfg(ctx, r, sources); err != nil {
+			return
+		}
+		var key string
+		if key, err = b.key(ctx, r, "pack", cfg, sources, opt, pkgPath); err != nil || b.restore(key, r) {
+			return
+		}
+		var file string
+		if file, err = b.compile(ctx, r, tmp, sources, cfg, true); err != nil {
+			return
+		}
+		var sym *SymbolLayer
+		if sym, err = b.symbols(ctx, r, opt); err != nil {
+			return
+		}
+		var deps map[string]string
+		if !opt.NoPkg {
+			if deps, err = opt.dependencies(cfg, sym); err != nil {
+				return
+			}
+		}
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		var data []byte
+		if data, err = b.pack(r, sym, []string{file}, []string{pkgPath}, deps); err != nil {
+			return
+		}
+		r.Name = b.name(strings.TrimSuffix(filepath.Base(sources[0]), ".go"), ".linkable")
+		r.Data = data
+		r.Requires = opt.Layers
+		b.store(key, r)
+		return
+	})
+	return
+}
+
+// build run f in a temporary directory, panics are recovered as ErrBuild of the running step.
+func (b *Builder) build(r *BuildResult, f func(tmp string) error) (err error) {
+	var tmp string
+	if tmp, err = os.MkdirTemp("", "dynamic-build-*"); err != nil {
+		return
+	}
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("%w: %s: %v", ErrBuild, r.step, x)
+			r.Diagnostics = append(r.Diagnostics, Diagnostic{Step: r.step, Message: fmt.Sprint(x)})
+		}
+		if b.Retain != "" {
+			if x := CopyDir(tmp, b.Retain, nil); x != nil && err == nil {
+				err = x
+			}
+		}
+		if !b.Debug {
+			_ = os.RemoveAll(tmp)
+		} else {
+			log.Printf("keep build directory %s", tmp)
+		}
+	}()
+	if err = f(tmp); err == nil {
+		h := sha256.Sum256(r.Data)
+		r.Hash = hex.EncodeToString(h[:])
+	}
+	return
+}
+
+// name of the artifact with extension.
+func (b *Builder) name(def, ext string) string {
+	if b.Name != "" {
+		return b.Name + ext
+	}
+	return def + ext
+}
+
+// Output resolve the path of artifact, output is used if not empty, otherwise the artifact named by [BuildResult.Name]
+// inside dir.
+func (r *BuildResult) Output(output, dir string) string {
+	if output != "" {
+		return output
+	}
+	return filepath.Join(dir, r.Name)
+}
+
+// Write the artifact to file with its manifest if it's a linkable, parent directories are created if not exist.
+//
+// The manifest is written before the artifact, and the artifact is written to a temporary file then renamed, so
+// a watcher of the directory never sees a partial artifact.
+func (r *BuildResult) Write(file string) (err error) {
+	if err = os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return
+	}
+	if strings.HasSuffix(r.Name, ".linkable") {
+		if err = WriteManifest(file, r.Requires); err != nil {
+			return
+		}
+	}
+	return writeFile(file, r.Data)
+}
+
+// writeFile atomically by rename a temporary file in the same directory.
+func writeFile(file string, data []byte) (err error) {
+	var f *os.File
+	if f, err = os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*"); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return
+	}
+	if err = f.Chmod(0644); err != nil {
+		_ = f.Close()
+		return
+	}
+	if err = f.Close(); err != nil {
+		return
+	}
+	return os.Rename(f.Name(), file)
+}
+
+// compile sources with importcfg into tmp, returns the path of output. Paths under Dir are always trimmed when trim,
+// as linkables are expected to be identical wherever they are built.
+func (b *Builder) compile(ctx context.Context, r *BuildResult, tmp string, sources []string, cfg []byte, trim bool) (file string, err error) {
+	ic := filepath.Join(tmp, "importcfg")
+	if err = os.WriteFile(ic, cfg, 0644); err != nil {
+		return
+	}
+	file = filepath.Join(tmp, strings.TrimSuffix(filepath.Base(sources[0]), ".go"))
+	args := []string{"tool", "compile", "-importcfg", ic}
+	if len(sources) == 1 {
+		file += ".o"
+	} else {
+		file += ".a"
+		args = append(args, "-pack")
+	}
+	args = append(args, b.Options.compile(b.Dir, "", trim)...)
+	args = append(append(args, "-o", file), sources...)
+	_, err = b.run(ctx, r, "compile", args...)
+	return
+}
+
+// importcfg generate content of importcfg for sources.
+func (b *Builder) importcfg(ctx context.Context, r *BuildResult, sources []string) (cfg []byte, err error) {
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("%w: missing sources", ErrBuild)
+	}
+	var out []byte
+	list := append([]string{"list", "-export"}, b.Options.list()...)
+	if out, err = b.run(ctx, r, "list", slices.Concat(list, []string{"-f", "{{.Imports}}"}, sources)...); err != nil {
+		return
+	}
+	s := strings.TrimSpace(string(out))
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	deps := strings.Fields(s)
+	if b.Debug {
+		log.Printf("deps %v", deps)
+	}
+	return b.run(ctx, r, "list", slices.Concat(list, []string{"-f", "{{if .Export}}packagefile {{.ImportPath}}={{.Export}}{{end}}", "std"}, deps)...)
+}
+
+// run a go command, stderr is collected as diagnostics.
+func (b *Builder) run(ctx context.Context, r *BuildResult, step string, args ...string) (out []byte, err error) {
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = b.Dir
+	cmd.Env = b.Options.env()
+	if b.Debug {
+		log.Printf("execute: %v", cmd.Args)
+	}
+	r.step = step
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err = cmd.Run()
+	r.Diagnostics = append(r.Diagnostics, diagnostics(step, stderr.Bytes())...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrBuild, step, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// list returns flags of 'go list'.
+func (o BuildOptions) list() (v []string) {
+	if len(o.Tags) > 0 {
+		v = append(v, "-tags="+strings.Join(o.Tags, ","))
+	}
+	if len(o.GCFlags) > 0 {
+		v = append(v, "-gcflags="+strings.Join(o.GCFlags, " "))
+	}
+	if o.TrimPath {
+		v = append(v, "-trimpath")
+	}
+	if o.Race {
+		v = append(v, "-race")
+	}
+	if o.Overlay != "" {
+		v = append(v, "-overlay="+o.Overlay)
+	}
+	return
+}
+
+// compile returns flags of 'go tool compile', with TrimPath or trim, paths under root are rewritten to prefix.
+func (o BuildOptions) compile(root, prefix string, trim bool) (v []string) {
+	v = append(v, o.GCFlags...)
+	if o.TrimPath || trim {
+		if d, err := filepath.Abs(root); err == nil {
+			v = append(v, "-trimpath="+d+"=>"+prefix)
+		}
+	}
+	if o.Race {
+		v = append(v, "-race")
+	}
+	return
+}
+
+// env returns environment of go commands, nil for inherit.
+func (o BuildOptions) env() (v []string) {
+	if len(o.Env) == 0 && o.GOFLAGS == "" {
+		return nil
+	}
+	v = append(os.Environ(), o.Env...)
+	if o.GOFLAGS != "" {
+		v = append(v, "GOFLAGS="+o.GOFLAGS)
+	}
+	return
+}
+
+// symbols to resolve against, symbols of the host executable if provided, otherwise symbols of current process.
+func (b *Builder) symbols(ctx context.Context, r *BuildResult, opt PackOptions) (sym *SymbolLayer, err error) {
+	r.step = "pack"
+	if opt.Host == "" {
+		return NewSymbolLayer()
+	}
+	var info *buildinfo.BuildInfo
+	if info, err = buildinfo.ReadFile(opt.Host); err != nil {
+		return nil, fmt.Errorf("%w: read build info of host %s: %w", ErrBuild, opt.Host, err)
+	}
+	var out []byte
+	if out, err = b.run(ctx, r, "env", "env", "GOVERSION"); err != nil {
+		return
+	}
+	r.step = "pack"
+	if v := strings.TrimSpace(string(out)); v != info.GoVersion {
+		msg := fmt.Sprintf("host built by %s but module compiled by %s", info.GoVersion, v)
+		r.Diagnostics = append(r.Diagnostics, Diagnostic{Step: "pack", File: opt.Host, Message: msg})
+		return nil, fmt.Errorf("%w: %s", ErrBuild, msg)
+	}
+	m := make(Symbols)
+	if err = goloader.RegSymbolWithPath(m, opt.Host); err != nil {
+		return nil, fmt.Errorf("%w: read symbols of host %s: %w", ErrBuild, opt.Host, err)
+	}
+	return m.Layer(), nil
+}
+
+// pack object files with dependencies into a linkable, symbols already in sym are not packed.
+func (b *Builder) pack(r *BuildResult, sym *SymbolLayer, files, pkgPaths []string, deps map[string]string) (data []byte, err error) {
+	r.step = "pack"
+	l := NewDynamic(sym, b.Debug)
+	if err = l.InitializeMany(files, pkgPaths); err != nil {
+		return
+	}
+	r.Missing = l.MissingSymbols()
+	slices.Sort(r.Missing)
+	for _, pkg := range slices.Sorted(maps.Keys(deps)) {
+		f := deps[pkg]
+		if b.Debug {
+			log.Printf("will pack with %s from %s", pkg, f)
+		}
+		if err = l.LoadDependencies(Dependency{File: f, PkgPath: pkg}); err != nil {
+			r.Diagnostics = append(r.Diagnostics, Diagnostic{Step: "pack", File: f, Message: err.Error()})
+			return nil, fmt.Errorf("%w: loading dependency %s from %s: %w", ErrBuild, pkg, f, err)
+		}
+	}
+	// paths of intermediate files differ between builds, only names are kept
+	for _, pkg := range l.GetLinker().Packages {
+		pkg.File = filepath.Base(pkg.File)
+	}
+	out := new(bytes.Buffer)
+	if err = Canonical(out, l.GetLinker()); err != nil {
+		return
+	}
+	return out.Bytes(), nil
+}
+
+// diagnostics parse output of go commands.
+func diagnostics(step string, b []byte) (v []Diagnostic) {
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		d := Diagnostic{Step: step, Message: line}
+		if m := position.FindStringSubmatch(line); m != nil {
+			d.File, d.Message = m[1], m[4]
+			d.Line, _ = strconv.Atoi(m[2])
+			d.Column, _ = strconv.Atoi(m[3])
+		}
+		v = append(v, d)
+	}
+	return
+}
+
+// dependencies parse dependency packages from importcfg, packages provided by layers are excluded. The sym is the
+// symbols to resolve against, see [Builder.symbols].
+func (o PackOptions) dependencies(cfg []byte, sym *SymbolLayer) (d map[string]string, err error) {
+	d = o.packages(cfg, sym)
+	for _, l := range o.Layers {
+		var pkgs []string
+		if pkgs, err = layerPackages(l); err != nil {
+			return
+		}
+		for _, p := range pkgs {
+			delete(d, p)
+		}
+	}
+	return
+}
+
+// layerPackages read packages provided by a layer.
+func layerPackages(file string) (v []string, err error) {
+	var f *os.File
+	if f, err = os.Open(file); err != nil {
+		return
+	}
+	defer fn.IgnoreClose(f)
+	var l *goloader.Linker
+	if l, err = goloader.UnSerialize(f); err != nil {
+		return nil, fmt.Errorf("%w: read layer %s: %w", ErrBuild, file, err)
+	}
+	for _, pkg := range l.Packages {
+		v = append(v, pkg.PkgPath)
+	}
+	return
+}
+
+// packages parse dependency packages from importcfg. With a host, packages linked into the host, by the symbols of
+// host, and packages can't be loaded twice are excluded, others are candidates.
+func (o PackOptions) packages(cfg []byte, sym *SymbolLayer) map[string]string {
+	if o.Host == "" {
+		return packages(cfg, o.Includes, o.Excludes)
+	}
+	host := linked(sym)
+	d := make(map[string]string)
+	s := bufio.NewScanner(bytes.NewReader(cfg))
+	for s.Scan() {
+		t := bytes.TrimPrefix(s.Bytes(), pkgPrefix)
+		i := bytes.IndexByte(t, '=')
+		if i < 0 {
+			continue
+		}
+		p := string(t[:i])
+		if bytes.HasPrefix(t, vendorPrefix) || host(p) || slices.ContainsFunc(hostPackages, func(s string) bool {
+			return check(p, s)
+		}) {
+			continue
+		}
+		d[p] = string(t[i+1:])
+	}
+	return d
+}
+
+// linked returns a function reports whether a package has any symbol in sym.
+func linked(sym *SymbolLayer) func(pkg string) bool {
+	names := slices.Sorted(maps.Keys(sym.Map()))
+	return func(pkg string) bool {
+		i, _ := slices.BinarySearch(names, pkg+".")
+		return i < len(names) && strings.HasPrefix(names[i], pkg+".")
+	}
+}
+
+// packages parse dependency packages from importcfg, standard and skipped packages are excluded.
+func packages(cfg []byte, includes, excludes []string) map[string]string {
+	ic := len(includes) != 0
+	ec := len(excludes) != 0
+	s := bufio.NewScanner(bytes.NewReader(cfg))
+	s.Split(bufio.ScanLines)
+	d := make(map[string]string)
+	for s.Scan() {
+		t := bytes.TrimPrefix(s.Bytes(), pkgPrefix)
+		i := bytes.IndexByte(t, '=')
+		if i < 0 {
+			continue
+		}
+		pkg := t[:i]
+		if bytes.HasPrefix(pkg, vendorPrefix) {
+			continue
+		}
+		p := string(pkg)
+		if checkAll(p) {
+			continue
+		}
+		if ic && slices.IndexFunc(includes, func(s string) bool {
+			return s == p || strings.HasPrefix(p, s)
+		}) >= 0 {
+			d[p] = string(t[i+1:])
+		} else if !ic && ec && slices.IndexFunc(excludes, func(s string) bool {
+			return s == p || strings.HasPrefix(p, s)
+		}) < 0 {
+			d[p] = string(t[i+1:])
+		}
+	}
+	return d
+}
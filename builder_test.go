@@ -0,0 +1,196 @@
+package dynamic
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDiagnostics(t *testing.T) {
+	v := diagnostics("compile", []byte("./a.go:3:7: undefined: x\n\nsome error\n"))
+	if len(v) != 2 {
+		t.Fatal(v)
+	}
+	if v[0].File != "./a.go" || v[0].Line != 3 || v[0].Column != 7 || v[0].Message != "undefined: x" {
+		t.Fatal(v[0])
+	}
+	if v[1].File != "" || v[1].Message != "some error" {
+		t.Fatal(v[1])
+	}
+}
+
+func TestPackages(t *testing.T) {
+	cfg := []byte("packagefile fmt=/a/fmt.a\npackagefile github.com/x/y=/b/y.a\npackagefile github.com/x/z=/b/z.a\npackagefile vendor/golang.org/x/net=/c.a\n")
+	if d := packages(cfg, []string{"github.com/x/y"}, nil); len(d) != 1 || d["github.com/x/y"] != "/b/y.a" {
+		t.Fatal(d)
+	}
+	if d := packages(cfg, nil, []string{"github.com/x/y"}); len(d) != 1 || d["github.com/x/z"] != "/b/z.a" {
+		t.Fatal(d)
+	}
+	host := Symbols{"fmt.Println": 1, "github.com/x/y.V": 2, "type:*github.com/x/z.T": 3}.Layer()
+	if d := (PackOptions{Host: "host", Includes: []string{"github.com/x/y"}}).packages(cfg, host); len(d) != 1 || d["github.com/x/z"] != "/b/z.a" {
+		t.Fatal(d)
+	}
+}
+
+func TestBuilderCompile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "bad.go"), []byte("package sample\n\nvar X = y\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := (&Builder{Dir: dir}).Compile(context.Background(), []string{"bad.go"})
+	if !errors.Is(err, ErrBuild) {
+		t.Fatalf("should fail: %v", err)
+	}
+	if len(r.Diagnostics) == 0 {
+		t.Fatal("missing diagnostics")
+	}
+	t.Log(r.Diagnostics)
+}
+
+func TestBuildOptions(t *testing.T) {
+	r, err := (&Builder{Dir: "testdata", Options: BuildOptions{
+		Tags: []string{"a", "b"},
+		Env:  []string{"GOOS=" + runtime.GOOS},
+	}}).Compile(context.Background(), []string{"func.go"})
+	if err != nil {
+		t.Fatal(err, r.Diagnostics)
+	}
+	if r.Name != "func.o" || len(r.Data) == 0 {
+		t.Fatal(r.Name)
+	}
+	x, err := (&Builder{Dir: "testdata"}).Compile(context.Background(), []string{"func.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Hash == "" || x.Hash != r.Hash {
+		t.Fatalf("not reproducible %s != %s", x.Hash, r.Hash)
+	}
+	if v := (BuildOptions{Tags: []string{"a", "b"}, Race: true}).list(); !slices.Equal(v, []string{"-tags=a,b", "-race"}) {
+		t.Fatal(v)
+	}
+	if v := (BuildOptions{GCFlags: []string{"-N", "-l"}, TrimPath: true}).compile("/src", "", false); !slices.Equal(v, []string{"-N", "-l", "-trimpath=/src=>"}) {
+		t.Fatal(v)
+	}
+	if v := (BuildOptions{}).compile("/src", "example.com/m", true); !slices.Equal(v, []string{"-trimpath=/src=>example.com/m"}) {
+		t.Fatal(v)
+	}
+}
+
+// sample writes a package depends on golang.org/x/mod into dir, which is not skipped by packing.
+func sample(t *testing.T, dir string) {
+	sum, err := os.ReadFile("go.sum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, l := range strings.Split(string(sum), "\n") {
+		if strings.HasPrefix(l, "golang.org/x/mod ") {
+			lines = append(lines, l)
+		}
+	}
+	for name, content := range map[string]string{
+		"go.mod":    "module example.com/sample\n\ngo 1.22\n\nrequire golang.org/x/mod v0.28.0\n",
+		"go.sum":    strings.Join(lines, "\n") + "\n",
+		"sample.go": "package sample\n\nimport \"golang.org/x/mod/semver\"\n\nfunc Major(v string) string {\n\treturn semver.Major(v)\n}\n",
+	} {
+		if err = os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPackReproducible(t *testing.T) {
+	for name, pack := range map[string]func(dir string) (*BuildResult, error){
+		"pack": func(dir string) (*BuildResult, error) {
+			sample(t, dir)
+			return (&Builder{Dir: dir}).Pack(context.Background(), []string{"sample.go"}, "example.com/sample", PackOptions{Includes: []string{"golang.org/x/mod/semver"}})
+		},
+		"module": func(dir string) (*BuildResult, error) {
+			if err := CopyDir(filepath.Join("testdata", "module"), dir, nil); err != nil {
+				return nil, err
+			}
+			return (&Builder{Dir: dir}).PackModule(context.Background(), nil, PackOptions{})
+		},
+	} {
+		// built in different directories, as from different checkouts
+		var v []*BuildResult
+		for range 2 {
+			r, err := pack(t.TempDir())
+			if err != nil {
+				t.Fatal(name, err, r)
+			}
+			v = append(v, r)
+		}
+		r, x := v[0], v[1]
+		if !strings.HasSuffix(r.Name, ".linkable") || !bytes.Equal(r.Data, x.Data) {
+			t.Fatalf("%s not reproducible %s != %s", name, r.Hash, x.Hash)
+		}
+		if name == "pack" && !bytes.Contains(r.Data, []byte("golang.org/x/mod/semver")) {
+			t.Fatalf("%s dependency not packed", name)
+		}
+	}
+}
+
+func TestBuilderPanic(t *testing.T) {
+	r := new(BuildResult)
+	b := new(Builder)
+	err := b.build(r, func(tmp string) error {
+		if _, err := b.run(context.Background(), r, "env", "env", "GOVERSION"); err != nil {
+			return err
+		}
+		panic("broken")
+	})
+	if !errors.Is(err, ErrBuild) || len(r.Diagnostics) != 1 || r.Diagnostics[0].Step != "env" {
+		t.Fatal(err, r.Diagnostics)
+	}
+}
+
+func TestPacks(t *testing.T) {
+	dir := t.TempDir()
+	if err := CopyFile(filepath.Join("testdata", "func.go"), filepath.Join(dir, "func.go"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := Packs(false, []string{filepath.Join(dir, "func.go")}, "sample", true, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "func.linkable")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuilderOutput(t *testing.T) {
+	dir := t.TempDir()
+	r, err := (&Builder{Dir: "testdata", Name: "feature", Retain: filepath.Join(dir, "retain")}).Compile(context.Background(), []string{"func.go"})
+	if err != nil {
+		t.Fatal(err, r.Diagnostics)
+	}
+	if r.Name != "feature.o" {
+		t.Fatal(r.Name)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "retain", "func.o")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "retain", "importcfg")); err != nil {
+		t.Fatal(err)
+	}
+	out := r.Output("", filepath.Join(dir, "out"))
+	if out != filepath.Join(dir, "out", "feature.o") {
+		t.Fatal(out)
+	}
+	if r.Output("x.o", dir) != "x.o" {
+		t.Fatal("output should be used")
+	}
+	if err = r.Write(out); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(out); err != nil || !bytes.Equal(b, r.Data) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,217 @@
+package dynamic
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ZenLiuCN/fn"
+)
+
+type (
+	// Cache is a local build cache, artifacts are keyed by the hash of sources, importcfg, go version and options.
+	// It's safe for concurrent builds and processes, entries are written atomically.
+	Cache struct {
+		Dir string
+	}
+	// CacheStats is the usage of a Cache.
+	CacheStats struct {
+		Entries int
+		Size    int64
+	}
+	// cacheEntry is the stored part of a BuildResult.
+	cacheEntry struct {
+		Name     string
+		Data     []byte
+		Missing  []string
+		Requires []string
+	}
+	// cacheKey hash inputs of a build.
+	cacheKey struct {
+		h hash.Hash
+	}
+)
+
+// DefaultCache returns the cache under the user cache directory, such as '~/.cache/dynamic/build'.
+func DefaultCache() (*Cache, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return &Cache{Dir: filepath.Join(dir, "dynamic", "build")}, nil
+}
+
+// file of an entry.
+func (c *Cache) file(key string) string {
+	return filepath.Join(c.Dir, key[:2], key)
+}
+
+// get an entry into r.
+func (c *Cache) get(key string, r *BuildResult) bool {
+	f, err := os.Open(c.file(key))
+	if err != nil {
+		return false
+	}
+	defer fn.IgnoreClose(f)
+	var e cacheEntry
+	if err = gob.NewDecoder(f).Decode(&e); err != nil {
+		return false
+	}
+	r.Name, r.Data, r.Missing, r.Requires, r.Cached = e.Name, e.Data, e.Missing, e.Requires, true
+	return true
+}
+
+// put r as an entry.
+func (c *Cache) put(key string, r *BuildResult) (err error) {
+	file := c.file(key)
+	if err = os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return
+	}
+	var f *os.File
+	if f, err = os.CreateTemp(filepath.Dir(file), key+".*"); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+	err = gob.NewEncoder(f).Encode(cacheEntry{Name: r.Name, Data: r.Data, Missing: r.Missing, Requires: r.Requires})
+	if x := f.Close(); err == nil {
+		err = x
+	}
+	if err != nil {
+		return
+	}
+	return os.Rename(f.Name(), file)
+}
+
+// Clean remove all entries.
+func (c *Cache) Clean() error {
+	return os.RemoveAll(c.Dir)
+}
+
+// Stats count entries and their size.
+func (c *Cache) Stats() (s CacheStats, err error) {
+	err = filepath.WalkDir(c.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		i, err := d.Info()
+		if err != nil {
+			return err
+		}
+		s.Entries++
+		s.Size += i.Size()
+		return nil
+	})
+	return
+}
+
+func (s CacheStats) String() string {
+	return fmt.Sprintf("%d entries, %d bytes", s.Entries, s.Size)
+}
+
+func (k cacheKey) add(s ...string) {
+	for _, x := range s {
+		_, _ = fmt.Fprintf(k.h, "%d:%s;", len(x), x)
+	}
+}
+
+func (k cacheKey) file(name string) (err error) {
+	var f *os.File
+	if f, err = os.Open(name); err != nil {
+		return
+	}
+	defer fn.IgnoreClose(f)
+	k.add(name)
+	_, err = io.Copy(k.h, f)
+	return
+}
+
+// key of a build from its kind, importcfg, source files and options, empty when caching is disabled.
+//
+// The go version, target platform, symbols to resolve against and layers are also part of the key.
+func (b *Builder) key(ctx context.Context, r *BuildResult, kind string, cfg []byte, files []string, opt PackOptions, extra ...string) (key string, err error) {
+	if b.Cache == nil {
+		return
+	}
+	k := cacheKey{h: sha256.New()}
+	var out []byte
+	if out, err = b.run(ctx, r, "env", "env", "GOVERSION", "GOOS", "GOARCH", "GOEXPERIMENT"); err != nil {
+		return
+	}
+	var o []byte
+	if o, err = json.Marshal(b.Options); err != nil {
+		return
+	}
+	k.add(kind, string(out), string(o), b.Name, fmt.Sprint(opt.NoPkg, opt.Includes, opt.Excludes), strings.Join(extra, " "))
+	k.add(string(bytes.TrimSpace(cfg)))
+	for _, f := range files {
+		if !filepath.IsAbs(f) {
+			f = filepath.Join(b.Dir, f)
+		}
+		if err = k.file(f); err != nil {
+			return
+		}
+	}
+	if kind != "compile" {
+		// symbols of the host, or of current process when not provided
+		host := opt.Host
+		if host == "" {
+			if host, err = os.Executable(); err != nil {
+				return
+			}
+		}
+		var id string
+		if id, err = BuildID(host); err != nil {
+			return
+		}
+		k.add(id)
+	}
+	for _, l := range opt.Layers {
+		if err = k.file(l); err != nil {
+			return
+		}
+	}
+	return hex.EncodeToString(k.h.Sum(nil)), nil
+}
+
+// restore r from cache by key, never restored when intermediate files are retained.
+func (b *Builder) restore(key string, r *BuildResult) bool {
+	if key == "" || b.Retain != "" || !b.Cache.get(key, r) {
+		return false
+	}
+	if b.Debug {
+		log.Printf("cached %s", r.Name)
+	}
+	return true
+}
+
+// store r into cache by key, failures are only logged.
+func (b *Builder) store(key string, r *BuildResult) {
+	if key == "" {
+		return
+	}
+	if err := b.Cache.put(key, r); err != nil {
+		log.Printf("write build cache %s: %v", key, err)
+	}
+}
@@ -0,0 +1,90 @@
+package dynamic
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(src, []byte("package main\n\nfunc Hello() string { return \"hello\" }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b := &Builder{Dir: dir, Cache: &Cache{Dir: filepath.Join(dir, "cache")}}
+	r, err := b.Compile(context.Background(), []string{"main.go"})
+	if err != nil {
+		t.Fatal(err, r.Diagnostics)
+	}
+	if r.Cached {
+		t.Fatal("should not cached")
+	}
+	x, err := b.Compile(context.Background(), []string{"main.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !x.Cached || x.Hash != r.Hash || x.Name != r.Name {
+		t.Fatal(x.Cached, x.Name, x.Hash, r.Hash)
+	}
+	if err = os.WriteFile(src, []byte("package main\n\nfunc Hello() string { return \"world\" }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if x, err = b.Compile(context.Background(), []string{"main.go"}); err != nil || x.Cached {
+		t.Fatal(err, x.Cached)
+	}
+	b.Options.Tags = []string{"a"}
+	if x, err = b.Compile(context.Background(), []string{"main.go"}); err != nil || x.Cached {
+		t.Fatal(err, x.Cached)
+	}
+	b.Retain = filepath.Join(dir, "retain")
+	if x, err = b.Compile(context.Background(), []string{"main.go"}); err != nil || x.Cached {
+		t.Fatal(err, x.Cached)
+	}
+	if _, err = os.Stat(filepath.Join(b.Retain, "importcfg")); err != nil {
+		t.Fatal(err)
+	}
+	b.Retain = ""
+	s, err := b.Cache.Stats()
+	if err != nil || s.Entries != 3 || s.Size == 0 {
+		t.Fatal(s, err)
+	}
+	if err = b.Cache.Clean(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = b.Cache.Stats(); err != nil || s.Entries != 0 {
+		t.Fatal(s, err)
+	}
+}
+
+func TestPackCache(t *testing.T) {
+	dir := t.TempDir()
+	b := &Builder{Dir: "testdata", Cache: &Cache{Dir: filepath.Join(dir, "cache")}}
+	r, err := b.Pack(context.Background(), []string{"func.go"}, "sample", PackOptions{NoPkg: true})
+	if err != nil {
+		t.Fatal(err, r.Diagnostics)
+	}
+	if r.Cached {
+		t.Fatal("should not cached")
+	}
+	// keyed on the build id of current executable as no host provided
+	x, err := b.Pack(context.Background(), []string{"func.go"}, "sample", PackOptions{NoPkg: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !x.Cached || x.Hash != r.Hash || x.Name != r.Name || !slices.Equal(x.Missing, r.Missing) {
+		t.Fatal(x.Cached, x.Name, x.Hash, r.Hash)
+	}
+	if x, err = b.Pack(context.Background(), []string{"func.go"}, "sample", PackOptions{}); err != nil || x.Cached {
+		t.Fatal(err, x.Cached)
+	}
+	b.Retain = filepath.Join(dir, "retain")
+	if x, err = b.Pack(context.Background(), []string{"func.go"}, "sample", PackOptions{NoPkg: true}); err != nil || x.Cached {
+		t.Fatal(err, x.Cached)
+	}
+	if _, err = os.Stat(filepath.Join(b.Retain, "func.o")); err != nil {
+		t.Fatal(err)
+	}
+}
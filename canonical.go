@@ -0,0 +1,494 @@
+package dynamic
+
+import (
+	"bytes"
+	"cmp"
+	"encoding"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"math/bits"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// ErrUncanonical occurs when a value can't be encoded by [Canonical].
+var ErrUncanonical = errors.New("uncanonical value")
+
+// Canonical write v as a gob stream, which is decodable by [gob.Decoder] and byte-identical for equal values.
+//
+// It differs from [gob.Encoder] only by sorting entries of maps and assigning ids to concrete types of interfaces
+// inside maps by their names, which makes serialized linkers reproducible.
+// Types implement [gob.GobEncoder], [encoding.BinaryMarshaler] or [encoding.TextMarshaler] are not supported,
+// concrete types of interfaces must be registered by [gob.Register] with values rather than pointers.
+func Canonical(w io.Writer, v any) (err error) {
+	c := &canonical{ids: make(map[reflect.Type]int), next: firstTypeID}
+	x := reflect.ValueOf(v)
+	for x.Kind() == reflect.Pointer {
+		if x.IsNil() {
+			return fmt.Errorf("%w: nil pointer", ErrUncanonical)
+		}
+		x = x.Elem()
+	}
+	var id int
+	if id, err = c.typeID(x.Type()); err != nil {
+		return
+	}
+	body := new(bytes.Buffer)
+	putInt(body, int64(id))
+	if err = c.top(body, x); err != nil {
+		return
+	}
+	c.message(body.Bytes())
+	_, err = w.Write(c.out.Bytes())
+	return
+}
+
+// predefined type ids of gob.
+const (
+	gobBool      = 1
+	gobInt       = 2
+	gobUint      = 3
+	gobFloat     = 4
+	gobBytes     = 5
+	gobString    = 6
+	gobComplex   = 7
+	gobInterface = 8
+	firstTypeID  = 65
+)
+
+// wire types of gob, only field order matters.
+type (
+	gobCommon struct {
+		Name string
+		Id   int
+	}
+	gobArray struct {
+		Common gobCommon
+		Elem   int
+		Len    int
+	}
+	gobSlice struct {
+		Common gobCommon
+		Elem   int
+	}
+	gobStruct struct {
+		Common gobCommon
+		Field  []gobField
+	}
+	gobField struct {
+		Name string
+		Id   int
+	}
+	gobMap struct {
+		Common gobCommon
+		Key    int
+		Elem   int
+	}
+	gobWire struct {
+		ArrayT  *gobArray
+		SliceT  *gobSlice
+		StructT *gobStruct
+		MapT    *gobMap
+	}
+)
+
+var (
+	gobEncoder      = reflect.TypeFor[gob.GobEncoder]()
+	binaryMarshaler = reflect.TypeFor[encoding.BinaryMarshaler]()
+	textMarshaler   = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+type canonical struct {
+	ids  map[reflect.Type]int
+	next int
+	out  bytes.Buffer // messages, type definitions are written before values use them
+}
+
+// message write a message with its length.
+func (c *canonical) message(b []byte) {
+	putUint(&c.out, uint64(len(b)))
+	c.out.Write(b)
+}
+
+// typeID returns id of the base type, definitions of new types are written.
+func (c *canonical) typeID(t reflect.Type) (id int, err error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return gobBool, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return gobInt, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return gobUint, nil
+	case reflect.Float32, reflect.Float64:
+		return gobFloat, nil
+	case reflect.Complex64, reflect.Complex128:
+		return gobComplex, nil
+	case reflect.String:
+		return gobString, nil
+	case reflect.Interface:
+		return gobInterface, nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return gobBytes, nil
+		}
+	case reflect.Array, reflect.Map, reflect.Struct:
+	default:
+		return 0, fmt.Errorf("%w: unsupported type %s", ErrUncanonical, t)
+	}
+	if id, ok := c.ids[t]; ok {
+		return id, nil
+	}
+	if pt := reflect.PointerTo(t); t.Implements(gobEncoder) || pt.Implements(gobEncoder) ||
+		t.Implements(binaryMarshaler) || pt.Implements(binaryMarshaler) ||
+		t.Implements(textMarshaler) || pt.Implements(textMarshaler) {
+		return 0, fmt.Errorf("%w: marshaler type %s", ErrUncanonical, t)
+	}
+	id = c.next
+	c.next++
+	c.ids[t] = id
+	common := gobCommon{Name: t.String(), Id: id}
+	if t.Name() != "" {
+		common.Name = t.Name()
+	}
+	var w gobWire
+	switch t.Kind() {
+	case reflect.Array:
+		w.ArrayT = &gobArray{Common: common, Len: t.Len()}
+		if w.ArrayT.Elem, err = c.typeID(t.Elem()); err != nil {
+			return
+		}
+	case reflect.Slice:
+		w.SliceT = &gobSlice{Common: common}
+		if w.SliceT.Elem, err = c.typeID(t.Elem()); err != nil {
+			return
+		}
+	case reflect.Map:
+		w.MapT = &gobMap{Common: common}
+		if w.MapT.Key, err = c.typeID(t.Key()); err != nil {
+			return
+		}
+		if w.MapT.Elem, err = c.typeID(t.Elem()); err != nil {
+			return
+		}
+	case reflect.Struct:
+		w.StructT = &gobStruct{Common: common}
+		for _, f := range fields(t) {
+			x := gobField{Name: f.Name}
+			if x.Id, err = c.typeID(f.Type); err != nil {
+				return
+			}
+			w.StructT.Field = append(w.StructT.Field, x)
+		}
+	}
+	b := new(bytes.Buffer)
+	putInt(b, -int64(id))
+	if err = c.value(b, reflect.ValueOf(w)); err != nil {
+		return
+	}
+	c.message(b.Bytes())
+	return
+}
+
+// fields returns struct fields gob transmits.
+func fields(t reflect.Type) (v []reflect.StructField) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		x := f.Type
+		for x.Kind() == reflect.Pointer {
+			x = x.Elem()
+		}
+		if x.Kind() == reflect.Chan || x.Kind() == reflect.Func {
+			continue
+		}
+		v = append(v, f)
+	}
+	return
+}
+
+// top encode a top level value, which is framed by a zero field delta if not a struct.
+func (c *canonical) top(b *bytes.Buffer, v reflect.Value) error {
+	if v.Kind() != reflect.Struct {
+		putUint(b, 0)
+	}
+	return c.value(b, v)
+}
+
+// indirect dereference pointers, nil pointers are invalid.
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// zero reports whether gob omits the struct field.
+func zero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Complex64, reflect.Complex128:
+		return v.Complex() == 0
+	case reflect.String, reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Interface:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
+
+// value encode a dereferenced value.
+func (c *canonical) value(b *bytes.Buffer, v reflect.Value) (err error) {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			putUint(b, 1)
+		} else {
+			putUint(b, 0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		putInt(b, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		putUint(b, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		putFloat(b, v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		putFloat(b, real(v.Complex()))
+		putFloat(b, imag(v.Complex()))
+	case reflect.String:
+		putUint(b, uint64(v.Len()))
+		b.WriteString(v.String())
+	case reflect.Slice, reflect.Array:
+		putUint(b, uint64(v.Len()))
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			b.Write(v.Bytes())
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err = c.element(b, v.Index(i)); err != nil {
+				return
+			}
+		}
+	case reflect.Map:
+		if err = c.dynamicTypes(v); err != nil {
+			return
+		}
+		putUint(b, uint64(v.Len()))
+		type entry struct{ key, elem []byte }
+		entries := make([]entry, 0, v.Len())
+		for i := v.MapRange(); i.Next(); {
+			k, e := new(bytes.Buffer), new(bytes.Buffer)
+			if err = c.element(k, i.Key()); err != nil {
+				return
+			}
+			if err = c.element(e, i.Value()); err != nil {
+				return
+			}
+			entries = append(entries, entry{k.Bytes(), e.Bytes()})
+		}
+		slices.SortFunc(entries, func(a, b entry) int {
+			return bytes.Compare(a.key, b.key)
+		})
+		for _, e := range entries {
+			b.Write(e.key)
+			b.Write(e.elem)
+		}
+	case reflect.Struct:
+		last := -1
+		for i, f := range fields(v.Type()) {
+			x := v.FieldByIndex(f.Index)
+			if x = indirect(x); !x.IsValid() || zero(x) {
+				continue
+			}
+			putUint(b, uint64(i-last))
+			last = i
+			if err = c.value(b, x); err != nil {
+				return
+			}
+		}
+		putUint(b, 0)
+	case reflect.Interface:
+		return c.iface(b, v)
+	default:
+		return fmt.Errorf("%w: unsupported type %s", ErrUncanonical, v.Type())
+	}
+	return
+}
+
+// element encode an element of array, slice or map, nil pointers are not allowed.
+func (c *canonical) element(b *bytes.Buffer, v reflect.Value) error {
+	if v.Kind() == reflect.Interface {
+		return c.iface(b, v)
+	}
+	if v = indirect(v); !v.IsValid() {
+		return fmt.Errorf("%w: nil element", ErrUncanonical)
+	}
+	return c.value(b, v)
+}
+
+// dynamicTypes assign ids to concrete types of interfaces inside a map in order of their names, rather than the
+// random order of map iteration.
+func (c *canonical) dynamicTypes(v reflect.Value) (err error) {
+	if !hasInterface(v.Type(), make(map[reflect.Type]bool)) {
+		return
+	}
+	found := make(map[reflect.Type]struct{})
+	collect(v, found)
+	types := slices.Collect(maps.Keys(found))
+	slices.SortFunc(types, func(a, b reflect.Type) int {
+		return cmp.Or(strings.Compare(typeName(a), typeName(b)), strings.Compare(a.String(), b.String()))
+	})
+	for _, t := range types {
+		if _, err = c.typeID(t); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// hasInterface reports whether values of the type may contain interfaces.
+func hasInterface(t reflect.Type, seen map[reflect.Type]bool) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if v, ok := seen[t]; ok {
+		return v
+	}
+	seen[t] = false
+	var v bool
+	switch t.Kind() {
+	case reflect.Interface:
+		v = true
+	case reflect.Array, reflect.Slice:
+		v = hasInterface(t.Elem(), seen)
+	case reflect.Map:
+		v = hasInterface(t.Key(), seen) || hasInterface(t.Elem(), seen)
+	case reflect.Struct:
+		for _, f := range fields(t) {
+			if v = hasInterface(f.Type, seen); v {
+				break
+			}
+		}
+	}
+	seen[t] = v
+	return v
+}
+
+// collect concrete types of interfaces inside a value.
+func collect(v reflect.Value, found map[reflect.Type]struct{}) {
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		if v = indirect(v.Elem()); !v.IsValid() {
+			return
+		}
+		found[v.Type()] = struct{}{}
+	}
+	if v = indirect(v); !v.IsValid() {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice:
+		if !hasInterface(v.Type().Elem(), make(map[reflect.Type]bool)) {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			collect(v.Index(i), found)
+		}
+	case reflect.Map:
+		for i := v.MapRange(); i.Next(); {
+			collect(i.Key(), found)
+			collect(i.Value(), found)
+		}
+	case reflect.Struct:
+		for _, f := range fields(v.Type()) {
+			collect(v.FieldByIndex(f.Index), found)
+		}
+	}
+}
+
+// typeName returns the name of a concrete type sent with interface values.
+func typeName(t reflect.Type) string {
+	if t.Name() == "" {
+		return t.String()
+	}
+	if t.PkgPath() != "" {
+		return t.PkgPath() + "." + t.Name()
+	}
+	return t.Name()
+}
+
+// iface encode an interface value as registered name, type id and the framed concrete value.
+func (c *canonical) iface(b *bytes.Buffer, v reflect.Value) (err error) {
+	if v.IsNil() {
+		putUint(b, 0)
+		return
+	}
+	x := indirect(v.Elem())
+	if !x.IsValid() {
+		return fmt.Errorf("%w: nil pointer inside interface", ErrUncanonical)
+	}
+	name := typeName(x.Type())
+	putUint(b, uint64(len(name)))
+	b.WriteString(name)
+	var id int
+	if id, err = c.typeID(x.Type()); err != nil {
+		return
+	}
+	putInt(b, int64(id))
+	data := new(bytes.Buffer)
+	if err = c.top(data, x); err != nil {
+		return
+	}
+	putUint(b, uint64(data.Len()))
+	b.Write(data.Bytes())
+	return
+}
+
+func putUint(b *bytes.Buffer, x uint64) {
+	if x <= 0x7F {
+		b.WriteByte(uint8(x))
+		return
+	}
+	var buf [9]byte
+	binary.BigEndian.PutUint64(buf[1:], x)
+	n := bits.LeadingZeros64(x) >> 3
+	buf[n] = uint8(n - 8)
+	b.Write(buf[n:])
+}
+
+func putInt(b *bytes.Buffer, i int64) {
+	var x uint64
+	if i < 0 {
+		x = uint64(^i<<1) | 1
+	} else {
+		x = uint64(i << 1)
+	}
+	putUint(b, x)
+}
+
+func putFloat(b *bytes.Buffer, f float64) {
+	putUint(b, bits.ReverseBytes64(math.Float64bits(f)))
+}
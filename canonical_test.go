@@ -0,0 +1,125 @@
+package dynamic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type (
+	canonicalSym struct {
+		Name   string
+		Kind   int
+		DupOK  bool
+		Data   []byte
+		Reloc  []canonicalReloc
+		Func   *canonicalFunc
+		hidden int
+	}
+	canonicalReloc struct {
+		Offset int
+		Sym    *canonicalSym
+		Size   uint8
+		Add    int64
+	}
+	canonicalFunc struct {
+		Args  uint32
+		File  []string
+		PCSP  [4]byte
+		Ratio float64
+	}
+	canonicalArch struct {
+		Name      string
+		ByteOrder binary.ByteOrder
+		PtrSize   int
+	}
+	canonicalData struct {
+		Code []byte
+	}
+	canonicalInt    struct{ V int }
+	canonicalString struct{ V string }
+	canonicalPair   struct{ A, B int }
+	canonicalLinker struct {
+		canonicalData
+		Data      canonicalData
+		SymMap    map[string]*canonicalSym
+		NameMap   map[string]int
+		Nested    map[string]map[string]int
+		Funcs     []*canonicalFunc
+		Arch      *canonicalArch
+		Any       []any
+		Values    map[string]any
+		Offset    int32
+		Adapted   bool
+		Callback  func()
+		Addresses map[uintptr]uint64
+	}
+)
+
+func TestCanonical(t *testing.T) {
+	gob.Register(binary.LittleEndian)
+	gob.Register(canonicalInt{})
+	gob.Register(canonicalString{})
+	gob.Register(canonicalPair{})
+	l := &canonicalLinker{
+		canonicalData: canonicalData{Code: []byte{1}},
+		Data:          canonicalData{Code: []byte{1, 2, 3}},
+		SymMap:        map[string]*canonicalSym{},
+		NameMap:       map[string]int{},
+		Nested:        map[string]map[string]int{"a": {"x": 1, "y": -2}, "b": {}},
+		Funcs:         []*canonicalFunc{{Args: 8, File: []string{"a.go"}, PCSP: [4]byte{1, 2}, Ratio: 0.5}},
+		Arch:          &canonicalArch{Name: "amd64", ByteOrder: binary.LittleEndian, PtrSize: 8},
+		Any:           []any{"s", 1, nil},
+		Values: map[string]any{
+			"int":    canonicalInt{V: 1},
+			"string": canonicalString{V: "s"},
+			"pair":   canonicalPair{A: 1, B: 2},
+			"plain":  2,
+		},
+		Offset:    -300,
+		Adapted:   true,
+		Addresses: map[uintptr]uint64{1 << 40: math64, 3: 0},
+	}
+	for i := 0; i < 100; i++ {
+		n := fmt.Sprintf("pkg.sym%d", i)
+		l.SymMap[n] = &canonicalSym{Name: n, Kind: i % 3, DupOK: i%2 == 0, Data: []byte(n), Reloc: []canonicalReloc{{Offset: i, Sym: &canonicalSym{Name: "x"}, Size: 4, Add: -int64(i)}}}
+		l.NameMap[n] = i * 1000
+	}
+	l.SymMap["pkg.func"] = &canonicalSym{Name: "pkg.func", Func: &canonicalFunc{Args: 16, File: []string{"b.go"}}}
+	var first []byte
+	for i := 0; i < 10; i++ {
+		b := new(bytes.Buffer)
+		if err := Canonical(b, l); err != nil {
+			t.Fatal(err)
+		}
+		if first == nil {
+			first = b.Bytes()
+		} else if !bytes.Equal(first, b.Bytes()) {
+			t.Fatal("not reproducible")
+		}
+	}
+	x := new(canonicalLinker)
+	if err := gob.NewDecoder(bytes.NewReader(first)).Decode(x); err != nil {
+		t.Fatal(err)
+	}
+	std := new(bytes.Buffer)
+	if err := gob.NewEncoder(std).Encode(l); err != nil {
+		t.Fatal(err)
+	}
+	y := new(canonicalLinker)
+	if err := gob.NewDecoder(std).Decode(y); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(y, x) {
+		t.Fatalf("mismatch decoded:\n%+v\n%+v", y, x)
+	}
+	s := struct{ Fn func() }{}
+	if err := Canonical(new(bytes.Buffer), s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const math64 = 1<<64 - 1
@@ -1,18 +1,71 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"debug/buildinfo"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime/debug"
 	"strings"
+	"time"
 
 	. "github.com/ZenLiuCN/dynamic"
 	"github.com/pkujhd/goloader"
 	"github.com/urfave/cli/v3"
 )
 
+var buildFlags = []cli.Flag{
+	&cli.StringSliceFlag{Name: "tags", Usage: "build tags"},
+	&cli.StringFlag{Name: "gcflags", Usage: "flags of go tool compile, such as '-N -l' for debugging"},
+	&cli.BoolFlag{Name: "trimpath", Usage: "remove file system paths from compiled output"},
+	&cli.BoolFlag{Name: "race", Usage: "enable data race detection"},
+	&cli.StringFlag{Name: "goflags", Usage: "override GOFLAGS of environment"},
+	&cli.StringSliceFlag{Name: "env", Usage: "extra environment variables as KEY=VALUE"},
+	&cli.StringFlag{Name: "overlay", Usage: "overlay file for go list, such as printed by prepare"},
+	&cli.StringFlag{Name: "host", Aliases: []string{"x"}, Usage: "host executable built by the same go version, pack only packages not linked into the host, includes and excludes will no effect"},
+	&cli.StringSliceFlag{Name: "layer", Aliases: []string{"l"}, Usage: "required layer linkable, packages it provides are not packed"},
+	&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Usage: "artifact file, default named by the sources, module or layer inside --out-dir"},
+	&cli.StringFlag{Name: "out-dir", Value: ".", Usage: "directory of artifact when --output is not provided"},
+	&cli.StringFlag{Name: "retain", Usage: "directory to retain intermediate files such as .o, .a and importcfg, discarded if not provided, the build cache is not restored from when set"},
+	&cli.BoolFlag{Name: "no-cache", Usage: "disable the build cache"},
+}
+
+// buildOptions from buildFlags.
+func buildOptions(cmd *cli.Command) BuildOptions {
+	return BuildOptions{
+		Tags:     cmd.StringSlice("tags"),
+		GCFlags:  strings.Fields(cmd.String("gcflags")),
+		TrimPath: cmd.Bool("trimpath"),
+		Race:     cmd.Bool("race"),
+		GOFLAGS:  cmd.String("goflags"),
+		Env:      cmd.StringSlice("env"),
+		Overlay:  cmd.String("overlay"),
+	}
+}
+
+// builder from buildFlags.
+func builder(cmd *cli.Command) (*Builder, error) {
+	c, err := cache(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return &Builder{Debug: cmd.Bool("debug"), Options: buildOptions(cmd), Retain: cmd.String("retain"), Cache: c}, nil
+}
+
+// cache is the default build cache unless disabled by flag.
+func cache(cmd *cli.Command) (*Cache, error) {
+	if cmd.Bool("no-cache") {
+		return nil, nil
+	}
+	return DefaultCache()
+}
+
 func main() {
 
 	if err := (&cli.Command{
@@ -29,13 +82,13 @@ func main() {
 			{
 				Name:   "compile",
 				Action: compile,
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.BoolFlag{Name: "pack", Aliases: []string{"a"}, Usage: "pack dependency packages"},
 					&cli.BoolFlag{Name: "noPkg", Aliases: []string{"n"}, Usage: "pack without dependencies"},
 					&cli.StringSliceFlag{Name: "includes", Aliases: []string{"c"}, Usage: "pack dependency packages only included, if provided excludes will no effect."},
 					&cli.StringSliceFlag{Name: "excludes", Aliases: []string{"e"}, Usage: "pack dependencies packages excluded"},
 					&cli.StringFlag{Name: "pkg", Aliases: []string{"k"}, Usage: "package import path, required with -a or --pack"},
-				},
+				}, buildFlags...),
 				Usage: "compile go source to objfile or go archive. the arguments can be list of go sources or '.' for lookup at working directory.",
 				Arguments: []cli.Argument{
 					&cli.StringArgs{
@@ -48,12 +101,21 @@ func main() {
 			{
 				Name:   "prepare",
 				Action: prepare,
-				Usage:  "copy internals of go sdk",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "dir", Usage: "directory of overlay files, default the user cache directory"},
+				},
+				Usage: "write an overlay provides internals of go sdk required by goloader, then print its path. " +
+					"the go sdk is never modified, build host by 'go build -overlay=<path>', " +
+					"test host by 'go test -vet=off -overlay=<path>'",
 			},
 			{
 				Name:   "clean",
 				Action: clean,
-				Usage:  "remove copied internals of go sdk",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "dir", Usage: "directory of overlay files, default the user cache directory"},
+					&cli.BoolFlag{Name: "legacy", Usage: "also remove internals copied into go sdk by former versions"},
+				},
+				Usage: "remove the overlay of go sdk",
 			},
 			{
 				Name:   "imports",
@@ -85,13 +147,156 @@ func main() {
 			{
 				Name:   "module",
 				Action: module,
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.BoolFlag{Name: "noPkg", Aliases: []string{"n"}, Usage: "pack without dependencies"},
 					&cli.StringSliceFlag{Name: "includes", Aliases: []string{"c"}, Usage: "pack dependencies packages only included, if provided, excludes will no effect."},
 					&cli.StringSliceFlag{Name: "excludes", Aliases: []string{"e"}, Usage: "pack dependencies packages excluded"},
-					&cli.StringFlag{Name: "pkg", Aliases: []string{"k"}, Usage: "package import path, required with -a or --pack"},
+					&cli.StringFlag{Name: "pkg", Aliases: []string{"k"}, Usage: "package import path, if provided only compile go sources in working directory as the package"},
+				}, buildFlags...),
+				Usage: "compile packages of go module at working directory in dependency order to one linkable. the arguments are package patterns, default './...'",
+				Arguments: []cli.Argument{
+					&cli.StringArgs{
+						Name: "patterns",
+						Min:  0,
+						Max:  -1,
+					},
+				},
+			},
+			{
+				Name:   "watch",
+				Action: watch,
+				Flags: append([]cli.Flag{
+					&cli.BoolFlag{Name: "noPkg", Aliases: []string{"n"}, Usage: "pack without dependencies"},
+					&cli.StringSliceFlag{Name: "includes", Aliases: []string{"c"}, Usage: "pack dependencies packages only included, if provided, excludes will no effect."},
+					&cli.StringSliceFlag{Name: "excludes", Aliases: []string{"e"}, Usage: "pack dependencies packages excluded"},
+					&cli.StringFlag{Name: "pkg", Aliases: []string{"k"}, Usage: "package import path, if provided only compile go sources in working directory as the package"},
+					&cli.DurationFlag{Name: "interval", Aliases: []string{"i"}, Value: 500 * time.Millisecond, Usage: "interval of polling changes"},
+				}, buildFlags...),
+				Usage: "watch go sources of working directory, rebuild the module as the 'module' command on change. the arguments are package patterns, default './...'",
+				Arguments: []cli.Argument{
+					&cli.StringArgs{
+						Name: "patterns",
+						Min:  0,
+						Max:  -1,
+					},
+				},
+			},
+			{
+				Name:   "layer",
+				Action: layer,
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{Name: "name", Aliases: []string{"m"}, Value: "layer", Usage: "name of the layer linkable"},
+					&cli.StringSliceFlag{Name: "includes", Aliases: []string{"c"}, Usage: "pack dependencies packages only included, if provided, excludes will no effect."},
+					&cli.StringSliceFlag{Name: "excludes", Aliases: []string{"e"}, Usage: "pack dependencies packages excluded"},
+				}, buildFlags...),
+				Usage: "pack shared dependencies into a layer linkable, modules require it by --layer. the arguments are package patterns",
+				Arguments: []cli.Argument{
+					&cli.StringArgs{
+						Name: "patterns",
+						Min:  1,
+						Max:  -1,
+					},
+				},
+			},
+			{
+				Name:   "build",
+				Action: build,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "file", Aliases: []string{"f"}, Value: "dynamic.json", Usage: "project file declares modules"},
+					&cli.BoolFlag{Name: "no-cache", Usage: "disable the build cache"},
+				},
+				Usage: "build modules declared in project file in parallel. the arguments are names of modules to build, default all",
+				Arguments: []cli.Argument{
+					&cli.StringArgs{
+						Name: "modules",
+						Min:  0,
+						Max:  -1,
+					},
+				},
+			},
+			{
+				Name:  "cache",
+				Usage: "manage the build cache",
+				Commands: []*cli.Command{
+					{
+						Name:  "clean",
+						Usage: "remove all cached artifacts",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							c, err := DefaultCache()
+							if err != nil {
+								return err
+							}
+							return c.Clean()
+						},
+					},
+					{
+						Name:  "stats",
+						Usage: "print location and usage of the build cache",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							c, err := DefaultCache()
+							if err != nil {
+								return err
+							}
+							s, err := c.Stats()
+							if err != nil {
+								return err
+							}
+							fmt.Printf("%s: %s\n", c.Dir, s)
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:   "hoststubs",
+				Action: hoststubs,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "host", Aliases: []string{"x"}, Usage: "host executable, if omitted all unresolved symbols of modules are referenced"},
+					&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Value: "host_stubs.go", Usage: "generated go source file"},
+					&cli.StringFlag{Name: "package", Aliases: []string{"p"}, Usage: "package name of generated file, default $GOPACKAGE (set by go:generate) or main"},
+				},
+				Usage: "generate go source for host which keeps symbols required by modules. the arguments are module files, object files should suffix with '=pkgPath'. " +
+					"use with go:generate as '//go:generate compiler hoststubs -x ./host -o host_stubs.go module.linkable'",
+				Arguments: []cli.Argument{
+					&cli.StringArgs{
+						Name: "files",
+						Min:  1,
+						Max:  -1,
+					},
+				},
+			},
+			{
+				Name:   "modtypes",
+				Action: modtypes,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Value: "module_types.go", Usage: "generated go source file"},
+					&cli.StringFlag{Name: "package", Aliases: []string{"p"}, Usage: "package name of generated file, default $GOPACKAGE (set by go:generate) or main"},
+					&cli.StringFlag{Name: "host", Aliases: []string{"x"}, Usage: "host executable, if omitted all types imported by modules are registered"},
+				},
+				Usage: "generate RegisterModuleTypes for host which registers host types imported by modules. the arguments are module files, object files should suffix with '=pkgPath'.",
+				Arguments: []cli.Argument{
+					&cli.StringArgs{
+						Name: "files",
+						Min:  1,
+						Max:  -1,
+					},
+				},
+			},
+			{
+				Name:   "skew",
+				Action: skew,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "host", Aliases: []string{"x"}, Required: true, Usage: "host executable"},
+					&cli.BoolFlag{Name: "warn", Aliases: []string{"w"}, Usage: "only report version skews without failure"},
+				},
+				Usage: "check versions of module imports against build info of host. the arguments are module files, object files should suffix with '=pkgPath'.",
+				Arguments: []cli.Argument{
+					&cli.StringArgs{
+						Name: "files",
+						Min:  1,
+						Max:  -1,
+					},
 				},
-				Usage: "compile current work directory as go module to linkable",
 			},
 		},
 	}).Run(context.Background(), os.Args); err != nil {
@@ -100,26 +305,190 @@ func main() {
 }
 
 func module(ctx context.Context, cmd *cli.Command) (err error) {
-	d := cmd.Bool("debug")
-	var o []string
-	o, err = lookup()
+	_, err = exec.LookPath("go")
 	if err != nil {
+		return fmt.Errorf("missing go sdk: %w ", err)
+	}
+	var b *Builder
+	if b, err = builder(cmd); err != nil {
 		return
 	}
-	_, err = exec.LookPath("go")
+	if pk := cmd.String("k"); pk != "" {
+		var o []string
+		o, err = lookup()
+		if err != nil {
+			return
+		}
+		return pack(ctx, cmd, b, o, pk)
+	}
+	var r *BuildResult
+	r, err = b.PackModule(ctx, cmd.StringArgs("patterns"), PackOptions{
+		NoPkg:    cmd.Bool("n"),
+		Includes: cmd.StringSlice("c"),
+		Excludes: cmd.StringSlice("e"),
+		Host:     cmd.String("host"),
+		Layers:   cmd.StringSlice("layer"),
+	})
+	return write(cmd, r, err)
+}
+
+func watch(ctx context.Context, cmd *cli.Command) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	return Watch(ctx, ".", cmd.Duration("interval"), func(ctx context.Context) {
+		if err := module(ctx, cmd); err != nil && ctx.Err() == nil {
+			log.Printf("build failed: %s", err)
+		}
+	})
+}
+
+func pack(ctx context.Context, cmd *cli.Command, b *Builder, o []string, pk string) (err error) {
+	var r *BuildResult
+	r, err = b.Pack(ctx, o, pk, PackOptions{
+		NoPkg:    cmd.Bool("n"),
+		Includes: cmd.StringSlice("c"),
+		Excludes: cmd.StringSlice("e"),
+		Host:     cmd.String("host"),
+		Layers:   cmd.StringSlice("layer"),
+	})
+	return write(cmd, r, err)
+}
+
+// write the artifact to the path of output flags after reports diagnostics.
+func write(cmd *cli.Command, r *BuildResult, err error) error {
+	if r != nil {
+		for _, d := range r.Diagnostics {
+			log.Println(d)
+		}
+		if cmd.Bool("debug") {
+			for _, s := range r.Missing {
+				log.Printf("required %s", s)
+			}
+		}
+	}
 	if err != nil {
+		return err
+	}
+	out := r.Output(cmd.String("output"), cmd.String("out-dir"))
+	if err = r.Write(out); err != nil {
+		return err
+	}
+	fmt.Printf("%s  %s\n", r.Hash, out)
+	return nil
+}
+
+func layer(ctx context.Context, cmd *cli.Command) (err error) {
+	var b *Builder
+	if b, err = builder(cmd); err != nil {
+		return
+	}
+	var r *BuildResult
+	r, err = b.PackLayer(ctx, cmd.String("name"), cmd.StringArgs("patterns"), PackOptions{
+		Includes: cmd.StringSlice("c"),
+		Excludes: cmd.StringSlice("e"),
+		Host:     cmd.String("host"),
+		Layers:   cmd.StringSlice("layer"),
+	})
+	return write(cmd, r, err)
+}
+
+func build(ctx context.Context, cmd *cli.Command) (err error) {
+	d := cmd.Bool("debug")
+	if _, err = exec.LookPath("go"); err != nil {
 		return fmt.Errorf("missing go sdk: %w ", err)
 	}
-	if err = Imports(d, o); err != nil {
-		return fmt.Errorf("generate importcfg : %w ", err)
+	var p *Project
+	if p, err = ReadProject(cmd.String("file")); err != nil {
+		return
+	}
+	if p.Cache, err = cache(cmd); err != nil {
+		return
+	}
+	var errs []error
+	for _, r := range p.Build(ctx, d, cmd.StringArgs("modules")...) {
+		if r.BuildResult != nil {
+			for _, x := range r.Diagnostics {
+				log.Printf("%s: %s", r.Name, x)
+			}
+		}
+		if r.Err != nil {
+			log.Printf("%s: %s", r.Name, r.Err)
+			errs = append(errs, r.Err)
+			continue
+		}
+		fmt.Printf("%s  %s\n", r.Hash, r.Output)
+	}
+	return errors.Join(errs...)
+}
+
+func hoststubs(ctx context.Context, cmd *cli.Command) (err error) {
+	var m []ModuleFile
+	for _, s := range cmd.StringArgs("files") {
+		m = append(m, ParseModuleFile(s))
+	}
+	b := new(bytes.Buffer)
+	var skipped []string
+	if skipped, err = GenerateHostStubs(b, cmd.String("host"), packageName(cmd), m...); err != nil {
+		return
+	}
+	if cmd.Bool("debug") {
+		for _, s := range skipped {
+			log.Printf("skipped %s", s)
+		}
+	}
+	return os.WriteFile(cmd.String("output"), b.Bytes(), 0644)
+}
+
+func modtypes(ctx context.Context, cmd *cli.Command) (err error) {
+	var m []ModuleFile
+	for _, s := range cmd.StringArgs("files") {
+		m = append(m, ParseModuleFile(s))
+	}
+	b := new(bytes.Buffer)
+	var skipped []string
+	if skipped, err = GenerateModuleTypes(b, cmd.String("host"), packageName(cmd), m...); err != nil {
+		return
+	}
+	if cmd.Bool("debug") {
+		for _, s := range skipped {
+			log.Printf("skipped %s", s)
+		}
+	}
+	return os.WriteFile(cmd.String("output"), b.Bytes(), 0644)
+}
+
+func skew(ctx context.Context, cmd *cli.Command) (err error) {
+	var host *debug.BuildInfo
+	if host, err = buildinfo.ReadFile(cmd.String("host")); err != nil {
+		return
+	}
+	var infos Infos
+	for _, s := range cmd.StringArgs("files") {
+		var d *Dynamic
+		if d, err = OpenModule(make(Symbols), ParseModuleFile(s)); err != nil {
+			return
+		}
+		infos = append(infos, LinkerImportsIter(d.GetLinker())...)
+	}
+	v := CheckSkew(host, infos...)
+	for _, x := range v {
+		log.Println(x)
+	}
+	if cmd.Bool("warn") {
+		return nil
+	}
+	return SkewError(v)
+}
+
+// packageName of generated source, from flag or go:generate environment.
+func packageName(cmd *cli.Command) string {
+	if p := cmd.String("package"); p != "" {
+		return p
 	}
-	i := cmd.StringSlice("c")
-	e := cmd.StringSlice("e")
-	pk := cmd.String("k")
-	if pk == "" {
-		return fmt.Errorf("required argument -k|--pkgPath missing")
+	if p := os.Getenv("GOPACKAGE"); p != "" {
+		return p
 	}
-	return Packs(d, o, pk, cmd.Bool("n"), i, e)
+	return "main"
 }
 
 func linkers(ctx context.Context, cmd *cli.Command) (err error) {
@@ -177,19 +546,20 @@ func compile(ctx context.Context, cmd *cli.Command) (err error) {
 	if err != nil {
 		return fmt.Errorf("missing go sdk: %w ", err)
 	}
-	if err = Imports(d, o); err != nil {
-		return fmt.Errorf("generate importcfg : %w ", err)
+	var b *Builder
+	if b, err = builder(cmd); err != nil {
+		return
 	}
 	if cmd.Bool("a") {
-		i := cmd.StringSlice("c")
-		e := cmd.StringSlice("e")
 		pk := cmd.String("k")
 		if pk == "" {
 			return fmt.Errorf("required argument -k|--pkgPath missing")
 		}
-		return Packs(d, o, pk, cmd.Bool("n"), i, e)
+		return pack(ctx, cmd, b, o, pk)
 	}
-	return Compile(d, o, true)
+	var r *BuildResult
+	r, err = b.Compile(ctx, o)
+	return write(cmd, r, err)
 }
 
 func lookup() (v []string, err error) {
@@ -215,37 +585,55 @@ func lookup() (v []string, err error) {
 	return
 }
 
+// sdk detected by go command and directory of overlay files.
+func sdk(ctx context.Context, cmd *cli.Command) (s SDK, dir string, err error) {
+	if s, err = DetectSDK(ctx); err != nil {
+		return
+	}
+	if dir = cmd.String("dir"); dir == "" {
+		dir, err = DefaultSDKDir()
+	}
+	return
+}
+
 func clean(ctx context.Context, cmd *cli.Command) (err error) {
 	d := cmd.Bool("debug")
-	dir := os.ExpandEnv("$GOROOT/src/cmd/objfile")
+	s, dir, err := sdk(ctx, cmd)
+	if err != nil {
+		return
+	}
 	if d {
-		log.Printf("clean go sdk: %s", dir)
+		log.Printf("clean overlay of go sdk %s: %s", s.GOVERSION, s.Overlay(dir))
+	}
+	if err = s.Clean(dir); err != nil {
+		return
 	}
-	if _, err = os.Stat(dir); err == nil {
-		err = os.RemoveAll(dir)
+	if s.Legacy() {
+		legacy := filepath.Join(s.GOROOT, "src", "cmd", "objfile")
+		if !cmd.Bool("legacy") {
+			log.Printf("go sdk was patched by former versions, remove %s by --legacy", legacy)
+			return
+		}
+		err = os.RemoveAll(legacy)
 		if d {
-			log.Printf("removed %s", dir)
+			log.Printf("removed %s", legacy)
 		}
-	} else if d {
-		log.Printf("did nothing for %s", dir)
 	}
 	return
 }
 
 func prepare(ctx context.Context, cmd *cli.Command) (err error) {
-	d := cmd.Bool("debug")
-	src := os.ExpandEnv("$GOROOT/src/cmd/internal")
-	dir := os.ExpandEnv("$GOROOT/src/cmd/objfile")
-	if d {
-		log.Printf("prepare go sdk from %s to %s", src, dir)
+	s, dir, err := sdk(ctx, cmd)
+	if err != nil {
+		return
 	}
-	if _, err = os.Stat(dir); err != nil && os.IsNotExist(err) {
-		err = CopyDir(src, dir, nil)
-		if d {
-			log.Printf("copied %s from %s", dir, src)
-		}
-	} else if d {
-		log.Printf("did nothing for %s", dir)
+	if cmd.Bool("debug") {
+		log.Printf("prepare overlay of go sdk %s at %s", s.GOVERSION, s.GOROOT)
+	}
+	var file string
+	if file, err = s.Prepare(dir); err != nil {
+		return
 	}
+	fmt.Println(file)
 	return
 }
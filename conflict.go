@@ -0,0 +1,175 @@
+package dynamic
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+type (
+	// ConflictPolicy decides what to do when a module exports a symbol already registered.
+	ConflictPolicy int
+	// Conflict records a symbol exported by more than one owner.
+	Conflict struct {
+		Symbol   string
+		Owner    string // owner tries to register the symbol
+		Existing string // owner of the registered symbol, 'host' for symbols not registered by a Registrar
+		Policy   ConflictPolicy
+	}
+	// Registrar registers exported symbols of modules into a SymbolTable under a ConflictPolicy, and
+	// records every conflict seen. Conflicts are returned rather than logged, callers report them, such as by events.
+	//
+	// The zero value uses ConflictFirstWins. Registrar is not safe for concurrent use.
+	Registrar struct {
+		Policy    ConflictPolicy
+		owners    map[string]string   // symbol to owner
+		shadows   map[string][]shadow // overridden symbols by ConflictLastWins, latest last
+		conflicts []Conflict
+	}
+	shadow struct {
+		addr  uintptr
+		owner string // empty for host
+	}
+)
+
+const (
+	ConflictFirstWins ConflictPolicy = iota // keep the registered symbol, the conflict is only recorded
+	ConflictError                           // reject the module, see [Registrar.Check]
+	ConflictLastWins                        // override the registered symbol, restored when the new owner unregistered
+	ConflictPrefix                          // register the new symbol as 'owner:symbol'
+)
+
+// ErrConflict occurs when a module exports symbols already registered under ConflictError.
+var ErrConflict = errors.New("symbol conflict")
+
+func (c ConflictPolicy) String() string {
+	switch c {
+	case ConflictFirstWins:
+		return "first-wins"
+	case ConflictError:
+		return "error"
+	case ConflictLastWins:
+		return "last-wins"
+	case ConflictPrefix:
+		return "prefix"
+	default:
+		return "unknown"
+	}
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s: %s exported by %s already registered by %s", c.Policy, c.Symbol, c.Owner, c.Existing)
+}
+
+// Conflicts returns a copy of all conflicts seen.
+func (r *Registrar) Conflicts() []Conflict {
+	return slices.Clone(r.conflicts)
+}
+
+// Check returns conflicts of symbols accepted by keep, keep can be nil for all. Conflicts found are not recorded.
+func (r *Registrar) Check(sym SymbolTable, owner string, syms map[string]uintptr, keep func(string) bool) (v []Conflict) {
+	for s, u := range syms {
+		if keep != nil && !keep(s) {
+			continue
+		}
+		if x, ok := sym.Lookup(s); ok && x != u {
+			v = append(v, r.conflict(s, owner))
+		}
+	}
+	return
+}
+
+// CheckError returns an error joins all conflicts under ConflictError, otherwise nil.
+func (r *Registrar) CheckError(sym SymbolTable, owner string, syms map[string]uintptr, keep func(string) bool) error {
+	if r.Policy != ConflictError {
+		return nil
+	}
+	var errs []error
+	for _, c := range r.Check(sym, owner, syms, keep) {
+		errs = append(errs, fmt.Errorf("%w: %s", ErrConflict, c))
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Registrar) conflict(s, owner string) Conflict {
+	e, ok := r.owners[s]
+	if !ok {
+		e = "host"
+	}
+	return Conflict{Symbol: s, Owner: owner, Existing: e, Policy: r.Policy}
+}
+
+// Register symbols accepted by keep, keep can be nil for all. It returns new conflicts, and stops at the first error
+// of the SymbolTable.
+//
+// Under ConflictError, symbols conflicted are kept as ConflictFirstWins, use [Registrar.Check] before.
+func (r *Registrar) Register(sym SymbolTable, owner string, syms map[string]uintptr, keep func(string) bool) (v []Conflict, err error) {
+	if r.owners == nil {
+		r.owners = make(map[string]string)
+	}
+	for s, u := range syms {
+		if keep != nil && !keep(s) {
+			continue
+		}
+		x, ok := sym.Lookup(s)
+		if !ok {
+			if err = sym.Store(s, u); err != nil {
+				break
+			}
+			r.owners[s] = owner
+			continue
+		}
+		if x == u {
+			continue
+		}
+		v = append(v, r.conflict(s, owner))
+		switch r.Policy {
+		case ConflictLastWins:
+			if r.shadows == nil {
+				r.shadows = make(map[string][]shadow)
+			}
+			if err = sym.Store(s, u); err != nil {
+				break
+			}
+			r.shadows[s] = append(r.shadows[s], shadow{x, r.owners[s]})
+			r.owners[s] = owner
+		case ConflictPrefix:
+			err = sym.Store(owner+":"+s, u)
+		}
+		if err != nil {
+			break
+		}
+	}
+	r.conflicts = append(r.conflicts, v...)
+	return
+}
+
+// Unregister symbols accepted by keep, keep can be nil for all. Symbols overridden by the owner are restored.
+// Errors of the SymbolTable are joined.
+func (r *Registrar) Unregister(sym SymbolTable, owner string, syms map[string]uintptr, keep func(string) bool) error {
+	var errs []error
+	for s, u := range syms {
+		if keep != nil && !keep(s) {
+			continue
+		}
+		if x, ok := sym.Lookup(owner + ":" + s); ok && x == u {
+			errs = append(errs, sym.Remove(owner+":"+s))
+		}
+		stack := r.shadows[s]
+		if x, ok := sym.Lookup(s); ok && x == u {
+			delete(r.owners, s)
+			if n := len(stack); n > 0 {
+				errs = append(errs, sym.Store(s, stack[n-1].addr))
+				if stack[n-1].owner != "" {
+					r.owners[s] = stack[n-1].owner
+				}
+				r.shadows[s] = stack[:n-1]
+			} else {
+				errs = append(errs, sym.Remove(s))
+			}
+		} else if i := slices.Index(stack, shadow{u, owner}); i >= 0 {
+			r.shadows[s] = slices.Delete(stack, i, i+1)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,50 @@
+package dynamic
+
+import (
+	"errors"
+	"maps"
+	"testing"
+)
+
+func TestRegistrar(t *testing.T) {
+	for _, c := range []struct {
+		policy ConflictPolicy
+		want   map[string]uintptr
+	}{
+		{ConflictFirstWins, map[string]uintptr{"a.Run": 1, "a.Do": 3}},
+		{ConflictLastWins, map[string]uintptr{"a.Run": 2, "a.Do": 3}},
+		{ConflictPrefix, map[string]uintptr{"a.Run": 1, "a.Do": 3, "m2:a.Run": 2}},
+	} {
+		t.Run(c.policy.String(), func(t *testing.T) {
+			r := Registrar{Policy: c.policy}
+			sym := Symbols{}.Layer().Fork()
+			if _, err := r.Register(sym, "m1", map[string]uintptr{"a.Run": 1}, nil); err != nil {
+				t.Fatal(err)
+			}
+			v, err := r.Register(sym, "m2", map[string]uintptr{"a.Run": 2, "a.Do": 3}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(v) != 1 || v[0].Symbol != "a.Run" || v[0].Existing != "m1" || v[0].Owner != "m2" {
+				t.Fatalf("conflicts %v", v)
+			}
+			if m := sym.Map(); !maps.Equal(m, c.want) {
+				t.Fatalf("symbols %v, want %v", m, c.want)
+			}
+			if err = r.Unregister(sym, "m2", map[string]uintptr{"a.Run": 2, "a.Do": 3}, nil); err != nil {
+				t.Fatal(err)
+			}
+			if m := sym.Map(); len(m) != 1 || m["a.Run"] != 1 {
+				t.Fatalf("symbols after unregister %v", m)
+			}
+			if len(r.Conflicts()) != 1 {
+				t.Fatalf("conflicts recorded %v", r.Conflicts())
+			}
+		})
+	}
+	r := Registrar{Policy: ConflictError}
+	sym := Symbols{"a.Run": 1}
+	if err := r.CheckError(sym, "m", map[string]uintptr{"a.Run": 2}, nil); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expect ErrConflict, got %v", err)
+	}
+}
@@ -36,17 +36,23 @@ For more details see the cli help:
 
   - 1. Prepare GO sdk
 
-    use compile cli tool via `compiler prepare` or  use shell script named as `patch.sh`.
+    use compile cli tool via `compiler prepare` or  use shell script named as `patch.sh`, both write an overlay
+    into the user cache directory, see [DefaultSDKDir], or the directory given by `--dir` of both, and print its
+    path, the GO sdk itself is never modified. Build the host with
+    `go build -overlay=<path>` or `GOFLAGS=-overlay=<path>`, see [SDK.Prepare]. Test the host with
+    `go test -vet=off -overlay=<path>`, as vet can not enter directories only exist in the overlay.
 
   - 2. Work around with the dynamics
 
   - 3. Compile modules
 
-    use `compiler compile` or `compiler module ` to compile modules
+    use `compiler compile` or `compiler module ` to compile modules, or declare modules in a project file
+    such as 'dynamic.json' then build them all by `compiler build`, see [Project]. During development
+    `compiler watch` rebuilds the module on change.
 
-  - 3. Restore the GO SDK
+  - 4. Remove the overlay
 
-    use compile cli tool via `compiler clean` or use shell script named as `patch.sh`.
+    use compile cli tool via `compiler clean` or use shell script as `patch.sh clean`, with the same `--dir` if used.
 
 # Samples
 
@@ -43,33 +43,74 @@ type (
 	//	1. Must fetch and use one symbol as desired type inside one specific goroutine.
 	//	2. Dynamic itself can be used safe between goroutines, but not thread-safe.
 	Dynamic struct {
-		files []string
-		pkg   []string
-		Symbols
-		linker *goloader.Linker
-		module *goloader.CodeModule
-		debug  bool
+		files   []string
+		pkg     []string
+		symbols *SymbolLayer
+		own     Symbols             // types registered by the Dynamic
+		hidden  map[string]struct{} // symbols removed by goloader while linking the Dynamic
+		linker  *goloader.Linker
+		module  *goloader.CodeModule
+		debug   bool
 	}
-
-	// Symbols contains global resolved symbols
-	//
-	// If two Dynamic shares the same Symbols instance, it may depend on each other after make.
-	Symbols map[string]uintptr
 )
 
-func (s Symbols) ExistsSymbols() (v []string) {
-	for x := range maps.Keys(s) {
-		v = append(v, x)
+// NewDynamic create new dynamic links on provided symbols, which is [Symbols] or [SymbolLayer], an optional debug
+// parameter will enable debug logging inside Dynamic
+//
+// Types registered to the Dynamic are only visible to itself.
+func NewDynamic(sym SymbolSource, debug ...bool) (d *Dynamic) {
+	x := new(Dynamic)
+	x.symbols = sym.Layer()
+	x.own = make(Symbols)
+	x.hidden = make(map[string]struct{})
+	x.debug = debug != nil && len(debug) > 0 && debug[0]
+	return x
+}
+
+// regTypes register types only visible to the Dynamic.
+func (s *Dynamic) regTypes(types []any) {
+	if s.debug {
+		log.Println("register types", types)
+	}
+	goloader.RegTypes(s.own, types...)
+}
+
+// resolve run a function of goloader on symbols of the Dynamic.
+func (s *Dynamic) resolve(f func(symPtr map[string]uintptr) error) (err error) {
+	var removed []string
+	removed, err = s.symbols.link(s.own, s.hidden, f)
+	for _, name := range removed {
+		s.hidden[name] = struct{}{}
 	}
 	return
 }
 
-// NewDynamic create new dynamic with provided Symbols, an optional debug parameter will enable debug logging inside Dynamic
-func NewDynamic(sym Symbols, debug ...bool) (d *Dynamic) {
-	x := new(Dynamic)
-	x.Symbols = sym
-	x.debug = debug != nil && len(debug) > 0 && debug[0]
-	return x
+// GetSymbols returns the symbols the Dynamic links on.
+func (s *Dynamic) GetSymbols() *SymbolLayer {
+	return s.symbols
+}
+
+// Lookup a symbol visible to the Dynamic.
+func (s *Dynamic) Lookup(name string) (u uintptr, ok bool) {
+	if _, ok = s.hidden[name]; ok {
+		return 0, false
+	}
+	if u, ok = s.own[name]; ok {
+		return
+	}
+	return s.symbols.Lookup(name)
+}
+
+// ExistsSymbols returns names of all symbols visible to the Dynamic.
+func (s *Dynamic) ExistsSymbols() (v []string) {
+	m := s.symbols.Map()
+	maps.Copy(m, s.own)
+	for x := range maps.Keys(m) {
+		if _, ok := s.hidden[x]; !ok {
+			v = append(v, x)
+		}
+	}
+	return
 }
 func (s *Dynamic) internal() {}
 func (s *Dynamic) GetLinker() *goloader.Linker {
@@ -83,10 +124,7 @@ func (s *Dynamic) InitializeMany(file, pkg []string, types ...any) (err error) {
 		return ErrAlreadyInitialized
 	}
 	if len(types) > 0 {
-		if s.debug {
-			log.Println("register types", types)
-		}
-		goloader.RegTypes(s.Symbols, types...)
+		s.regTypes(types)
 	}
 	s.files = append(s.files, file...)
 	s.pkg = append(s.pkg, pkg...)
@@ -105,10 +143,7 @@ func (s *Dynamic) Initialize(file, pkg string, types ...any) (err error) {
 	s.files = append(s.files, file)
 	s.pkg = append(s.pkg, pkg)
 	if len(types) > 0 {
-		if s.debug {
-			log.Println("register types", types)
-		}
-		goloader.RegTypes(s.Symbols, types...)
+		s.regTypes(types)
 	}
 	if s.linker, err = goloader.ReadObj(file, pkg); err != nil {
 		return
@@ -123,10 +158,7 @@ func (s *Dynamic) InitializeSerialized(in io.Reader, types ...any) (err error) {
 		return ErrAlreadyInitialized
 	}
 	if len(types) > 0 {
-		if s.debug {
-			log.Println("register types", types)
-		}
-		goloader.RegTypes(s.Symbols, types...)
+		s.regTypes(types)
 	}
 	if s.linker, err = goloader.UnSerialize(in); err != nil {
 		return
@@ -152,11 +184,9 @@ func (s *Dynamic) LoadDependencies(dependency Dependency, dependencies ...Depend
 		paths = append(paths, d.PkgPath)
 		syms = append(syms, d.Symbols...)
 	}
-	err = s.linker.ReadDependPkgs(files, paths, syms, s.Symbols)
-	if err != nil {
-		return
-	}
-	return
+	return s.resolve(func(symPtr map[string]uintptr) error {
+		return s.linker.ReadDependPkgs(files, paths, syms, symPtr)
+	})
 }
 func (s *Dynamic) Link() (err error) {
 	if s.linker == nil {
@@ -165,7 +195,10 @@ func (s *Dynamic) Link() (err error) {
 	if s.module != nil {
 		return ErrLinked
 	}
-	if s.module, err = goloader.Load(s.linker, s.Symbols); err != nil {
+	if err = s.resolve(func(symPtr map[string]uintptr) (err error) {
+		s.module, err = goloader.Load(s.linker, symPtr)
+		return
+	}); err != nil {
 		return
 	}
 	if s.debug {
@@ -185,13 +218,21 @@ func (s *Dynamic) Exports() (v []string) {
 }
 
 func (s *Dynamic) Fetch(sym string) (u Sym, ok bool) {
+	return s.FetchIn("main", sym)
+}
+
+// FetchIn fetch a symbol of package pkgPath, the first name found in [Qualify] is used.
+func (s *Dynamic) FetchIn(pkgPath, sym string) (u Sym, ok bool) {
 	if s.module == nil {
 		ok = false
 		return
 	}
-	sym = checkPackage(sym)
 	var p uintptr
-	p, ok = s.module.Syms[sym]
+	for _, name := range Qualify(pkgPath, sym) {
+		if p, ok = s.module.Syms[name]; ok {
+			break
+		}
+	}
 	if !ok {
 		return
 	}
@@ -201,32 +242,45 @@ func (s *Dynamic) Fetch(sym string) (u Sym, ok bool) {
 	return Sym(p), ok
 }
 
-func checkPackage(sym string) string {
+// Qualify returns names a symbol may have in package pkgPath, which default to main.
+//
+// A name prefixed by the package path is returned as is. Otherwise, it's prefixed by the package path, and also
+// returned as is if it contains a '.', since a method 'T.Method' can't be told from a symbol of other package
+// 'other.Run' by name.
+func Qualify(pkgPath, sym string) []string {
+	if pkgPath == "" {
+		pkgPath = "main"
+	}
+	if strings.HasPrefix(sym, pkgPath+".") {
+		return []string{sym}
+	}
 	if strings.IndexByte(sym, '.') < 0 {
-		return "main." + sym
+		return []string{pkgPath + "." + sym}
 	}
-	return sym
+	return []string{pkgPath + "." + sym, sym}
 }
 func (s *Dynamic) MustFetch(sym string) (u Sym) {
 	if s.module == nil {
 		panic(ErrUninitialized)
 	}
-	sym = checkPackage(sym)
-	p, ok := s.module.Syms[sym]
+	u, ok := s.Fetch(sym)
 	if !ok {
 		panic(ErrMissingSymbol)
 	}
-	if s.debug {
-		log.Printf("found symbol: %x", p)
-	}
-	return Sym(p)
+	return
 }
 
 func (s *Dynamic) MissingSymbols() []string {
 	if s.linker == nil {
 		panic(ErrUninitialized)
 	}
-	return goloader.UnresolvedSymbols(s.linker, s.Symbols)
+	var v []string
+	for _, name := range goloader.UnresolvedSymbols(s.linker, nil) {
+		if _, ok := s.Lookup(name); !ok {
+			v = append(v, name)
+		}
+	}
+	return v
 }
 func (s *Dynamic) Serialize(out io.Writer) error {
 	if s.linker == nil {
@@ -247,7 +301,9 @@ func (s *Dynamic) Free(sync bool) {
 			s.module.Unload()
 			s.module = nil
 		}
-		s.Symbols = nil
+		s.symbols = nil
+		s.own = nil
+		s.hidden = nil
 		s.linker = nil
 		{
 			n := len(s.pkg)
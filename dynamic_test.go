@@ -9,6 +9,7 @@ import (
 
 	"bytes"
 	"encoding/hex"
+	"slices"
 	"sync"
 )
 
@@ -204,3 +205,24 @@ func TestLinkable(t *testing.T) {
 		t.Log(pkg.File, pkg.PkgPath)
 	}
 }
+
+func TestQualify(t *testing.T) {
+	for _, c := range []struct {
+		pkg, sym string
+		want     []string
+	}{
+		{"", "Run", []string{"main.Run"}},
+		{"main", "Run", []string{"main.Run"}},
+		{"main", "main.Run", []string{"main.Run"}},
+		{"main", "T.Name", []string{"main.T.Name", "T.Name"}},
+		{"sample", "Run", []string{"sample.Run"}},
+		{"sample", "sample.Run", []string{"sample.Run"}},
+		{"sample", "T.Name", []string{"sample.T.Name", "T.Name"}},
+		{"sample", "other.Run", []string{"sample.other.Run", "other.Run"}},
+		{"github.com/a/b", "Run", []string{"github.com/a/b.Run"}},
+	} {
+		if v := Qualify(c.pkg, c.sym); !slices.Equal(v, c.want) {
+			t.Errorf("Qualify(%q, %q) = %q, want %q", c.pkg, c.sym, v, c.want)
+		}
+	}
+}
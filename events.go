@@ -0,0 +1,118 @@
+package dynamic
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+type (
+	// EventKind is the kind of lifecycle Event.
+	EventKind int
+	// Event describes a lifecycle change of a package provided by a Dynamic module.
+	Event struct {
+		Kind     EventKind
+		PkgPath  string
+		Version  string
+		Source   string // source file, empty when unknown
+		Hash     string // hex encoded sha256 of source content, empty when unknown
+		Symbol   string // conflicted symbol, only for EventConflict
+		Duration time.Duration
+		Err      error // cause of EventFailed
+	}
+	// Listener receives Event, it's invoked synchronously and should not block.
+	Listener func(Event)
+	// Events dispatch Event to subscribed listeners, the zero value is ready for use.
+	Events struct {
+		mu        sync.RWMutex
+		seq       int
+		listeners map[int]Listener
+	}
+)
+
+const (
+	EventInitialized EventKind = iota + 1 // module initialized
+	EventLinked                           // module linked
+	EventReloaded                         // module reloaded by a new version
+	EventUnloaded                         // module unloaded
+	EventConflict                         // module exported a symbol already exists
+	EventFailed                           // module failed to initialize or link
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventInitialized:
+		return "initialized"
+	case EventLinked:
+		return "linked"
+	case EventReloaded:
+		return "reloaded"
+	case EventUnloaded:
+		return "unloaded"
+	case EventConflict:
+		return "conflict"
+	case EventFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// Subscribe register a listener, the returned function cancels the subscription.
+func (e *Events) Subscribe(l Listener) (cancel func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.listeners == nil {
+		e.listeners = make(map[int]Listener)
+	}
+	e.seq++
+	id := e.seq
+	e.listeners[id] = l
+	return func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		delete(e.listeners, id)
+	}
+}
+
+// Channel subscribe events into a buffered channel, events are dropped when the channel is full.
+// The returned function cancels the subscription and closes the channel.
+func (e *Events) Channel(size int) (ch <-chan Event, cancel func()) {
+	c := make(chan Event, size)
+	var once sync.Once
+	var mu sync.Mutex
+	closed := false
+	unsubscribe := e.Subscribe(func(ev Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case c <- ev:
+		default:
+		}
+	})
+	return c, func() {
+		once.Do(func() {
+			unsubscribe()
+			mu.Lock()
+			defer mu.Unlock()
+			closed = true
+			close(c)
+		})
+	}
+}
+
+// Emit deliver events to all listeners.
+func (e *Events) Emit(events ...Event) {
+	e.mu.RLock()
+	listeners := slices.Collect(maps.Values(e.listeners))
+	e.mu.RUnlock()
+	for _, ev := range events {
+		for _, l := range listeners {
+			l(ev)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package dynamic
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ZenLiuCN/fn"
+	"github.com/pkujhd/goloader"
+)
+
+// ModuleFile is a module to inspect, PkgPath is required by object files (.o) and go archives (.a),
+// serialized linkers (.linkable) carry their package paths.
+type ModuleFile struct {
+	File    string
+	PkgPath string
+}
+
+// ParseModuleFile parse 'file=pkgPath' as ModuleFile, package path default to main.
+func ParseModuleFile(s string) ModuleFile {
+	if i := strings.LastIndexByte(s, '='); i > 0 {
+		return ModuleFile{File: s[:i], PkgPath: s[i+1:]}
+	}
+	return ModuleFile{File: s, PkgPath: "main"}
+}
+
+// OpenModule initialize a Dynamic from a module file with layered symbols of sym.
+func OpenModule(sym SymbolSource, m ModuleFile) (d *Dynamic, err error) {
+	d = NewDynamic(sym)
+	if filepath.Ext(m.File) != ".linkable" {
+		err = d.Initialize(m.File, m.PkgPath)
+		return
+	}
+	var f *os.File
+	if f, err = os.Open(m.File); err != nil {
+		return
+	}
+	defer fn.IgnoreClose(f)
+	err = d.InitializeSerialized(f)
+	return
+}
+
+// moduleSymbols read unresolved symbols and imported packages of modules, packages provided by those modules are excluded.
+func moduleSymbols(sym SymbolSource, modules []ModuleFile) (missing, imports []string, err error) {
+	var provides []string
+	for _, m := range modules {
+		var d *Dynamic
+		if d, err = OpenModule(sym, m); err != nil {
+			return nil, nil, fmt.Errorf("open module %s: %w", m.File, err)
+		}
+		missing = append(missing, d.MissingSymbols()...)
+		for _, info := range LinkerImportsIter(d.GetLinker()) {
+			provides = append(provides, info.PkgPath)
+			for p := range info.Imports {
+				imports = append(imports, p)
+			}
+		}
+	}
+	imports = slices.DeleteFunc(imports, func(s string) bool {
+		return slices.Contains(provides, s)
+	})
+	slices.Sort(missing)
+	slices.Sort(imports)
+	return slices.Compact(missing), slices.Compact(imports), nil
+}
+
+// reference is a go expression references a symbol in a package.
+type reference struct {
+	pkg  string
+	expr string // with %s as the package name
+	typ  bool
+}
+
+// importable check if a package can be imported by the host, main, vendored and internal packages can't.
+func importable(pkg string) bool {
+	return pkg != "main" && !strings.HasPrefix(pkg, "vendor/") && !slices.Contains(strings.Split(pkg, "/"), "internal")
+}
+
+// referenceOf parse a symbol name into a go expression, only exported functions, methods, variables and named types
+// of importable packages can be referenced.
+func referenceOf(sym string, imports []string) (r reference, ok bool) {
+	if strings.ContainsAny(sym, "[]") {
+		return
+	}
+	var s string
+	s, r.typ = strings.CutPrefix(sym, "type:")
+	if r.typ {
+		s = strings.TrimPrefix(s, "*")
+	}
+	for _, p := range imports {
+		if strings.HasPrefix(s, p+".") && len(p) > len(r.pkg) {
+			r.pkg = p
+		}
+	}
+	if r.pkg == "" || !importable(r.pkg) {
+		return
+	}
+	s = s[len(r.pkg)+1:]
+	exported := func(v ...string) bool {
+		for _, x := range v {
+			if !token.IsIdentifier(x) || !token.IsExported(x) {
+				return false
+			}
+		}
+		return true
+	}
+	if r.typ {
+		r.expr = "(*%s." + s + ")(nil)"
+		return r, exported(s)
+	}
+	if t, ok := strings.CutPrefix(s, "(*"); ok {
+		t, m, _ := strings.Cut(t, ").")
+		r.expr = "(*%s." + t + ")." + m
+		return r, exported(t, m)
+	}
+	t, m, method := strings.Cut(s, ".")
+	if method {
+		r.expr = "%s." + t + "." + m
+		return r, exported(t, m)
+	}
+	r.expr = "%s." + s
+	return r, exported(s)
+}
+
+// render write a go source file references resolved symbols, skipped symbols are listed as comments.
+// The imports are extra packages imported without alias.
+func render(w io.Writer, header, pkgName string, imports []string, refs []reference, skipped []string, body func(b *bytes.Buffer, exprs []string)) (err error) {
+	var pkgs []string
+	for _, r := range refs {
+		pkgs = append(pkgs, r.pkg)
+	}
+	slices.Sort(pkgs)
+	pkgs = slices.Compact(pkgs)
+	b := new(bytes.Buffer)
+	b.WriteString(header)
+	fmt.Fprintf(b, "\npackage %s\n\nimport (\n", pkgName)
+	for _, p := range imports {
+		fmt.Fprintf(b, "\t%q\n", p)
+	}
+	for i, p := range pkgs {
+		fmt.Fprintf(b, "\tp%d %q\n", i, p)
+	}
+	b.WriteString(")\n")
+	if len(skipped) > 0 {
+		b.WriteString("\n// symbols can't be referenced:\n")
+		for _, s := range skipped {
+			fmt.Fprintf(b, "//   - %s\n", s)
+		}
+	}
+	exprs := make([]string, 0, len(refs))
+	for _, r := range refs {
+		exprs = append(exprs, fmt.Sprintf(r.expr, fmt.Sprintf("p%d", slices.Index(pkgs, r.pkg))))
+	}
+	body(b, exprs)
+	var src []byte
+	if src, err = format.Source(b.Bytes()); err != nil {
+		return fmt.Errorf("format generated source: %w", err)
+	}
+	_, err = w.Write(src)
+	return
+}
+
+// GenerateHostStubs write a go source file for the host executable, which references all symbols required by modules
+// but missing in the host, so that the linker of host will retain them. Symbols can't be referenced are returned.
+//
+// The host is the path of a go executable, if empty, all unresolved symbols of modules are referenced.
+func GenerateHostStubs(w io.Writer, host, pkgName string, modules ...ModuleFile) (skipped []string, err error) {
+	var sym Symbols
+	if sym, err = hostFileSymbols(host); err != nil {
+		return
+	}
+	var missing, imports []string
+	if missing, imports, err = moduleSymbols(sym, modules); err != nil {
+		return
+	}
+	var refs []reference
+	for _, s := range missing {
+		if r, ok := referenceOf(s, imports); ok {
+			refs = append(refs, r)
+		} else {
+			skipped = append(skipped, s)
+		}
+	}
+	err = render(w, "// Code generated by compiler hoststubs; DO NOT EDIT.\n", pkgName, nil, refs, skipped, func(b *bytes.Buffer, exprs []string) {
+		b.WriteString("\n// hostStubs keeps symbols required by dynamic modules from dead code elimination.\nvar hostStubs []any\n\nfunc init() {\n\thostStubs = []any{\n")
+		for _, e := range exprs {
+			fmt.Fprintf(b, "\t\t%s,\n", e)
+		}
+		b.WriteString("\t}\n}\n")
+	})
+	return
+}
+
+// hostFileSymbols read symbols of a host executable, empty if host is empty.
+func hostFileSymbols(host string) (sym Symbols, err error) {
+	sym = make(Symbols)
+	if host != "" {
+		if err = goloader.RegSymbolWithPath(sym, host); err != nil {
+			return nil, fmt.Errorf("read symbols of host %s: %w", host, err)
+		}
+	}
+	return
+}
+
+// GenerateModuleTypes write a go source file for the host executable, which declares function
+// 'RegisterModuleTypes(sym dynamic.Symbols)' registers all host types imported by modules into sym, see
+// [Symbols.RegisterTypes]. Type symbols can't be referenced are returned.
+//
+// The host is the path of a go executable, only types missing in the host are registered, if empty, all types
+// imported by modules are registered.
+func GenerateModuleTypes(w io.Writer, host, pkgName string, modules ...ModuleFile) (skipped []string, err error) {
+	var sym Symbols
+	if sym, err = hostFileSymbols(host); err != nil {
+		return
+	}
+	var missing, imports []string
+	if missing, imports, err = moduleSymbols(sym, modules); err != nil {
+		return
+	}
+	var refs []reference
+	for _, s := range missing {
+		if !strings.HasPrefix(s, "type:") {
+			continue
+		}
+		r, ok := referenceOf(s, imports)
+		switch {
+		case !ok:
+			skipped = append(skipped, s)
+		case !slices.Contains(refs, r):
+			refs = append(refs, r)
+		}
+	}
+	err = render(w, "// Code generated by compiler modtypes; DO NOT EDIT.\n", pkgName,
+		[]string{"github.com/ZenLiuCN/dynamic"}, refs, skipped, func(b *bytes.Buffer, exprs []string) {
+			b.WriteString("\n// RegisterModuleTypes register host types imported by dynamic modules into sym, such as the symbols\n")
+			b.WriteString("// passed to dynamic.NewDynamic or Pool.RegisterSymbols.\n")
+			b.WriteString("func RegisterModuleTypes(sym dynamic.Symbols) {\n\tsym.RegisterTypes(\n")
+			for _, e := range exprs {
+				fmt.Fprintf(b, "\t\t%s,\n", e)
+			}
+			b.WriteString("\t)\n}\n")
+		})
+	return
+}
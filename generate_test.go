@@ -0,0 +1,84 @@
+package dynamic
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReferenceOf(t *testing.T) {
+	imports := []string{"gopkg.in/yaml.v3", "github.com/a/b", "github.com/a/b/c", "github.com/a/b/internal/d",
+		"internal/abi", "vendor/golang.org/x/net/http2/hpack", "main"}
+	for sym, expr := range map[string]string{
+		"gopkg.in/yaml.v3.Marshal":                       "%s.Marshal",
+		"github.com/a/b.V":                               "%s.V",
+		"github.com/a/b/c.(*T).Do":                       "(*%s.T).Do",
+		"github.com/a/b/c.T.Do":                          "%s.T.Do",
+		"type:*github.com/a/b.T":                         "(*%s.T)(nil)",
+		"github.com/a/b.lower":                           "",
+		"github.com/a/b.F[go.shape.int]":                 "",
+		"github.com/x/y.F":                               "",
+		"type:[]github.com/a/b.T":                        "",
+		"github.com/a/b/internal/d.F":                    "",
+		"internal/abi.FuncPCABI0":                        "",
+		"vendor/golang.org/x/net/http2/hpack.NewEncoder": "",
+		"main.Run": "",
+	} {
+		r, ok := referenceOf(sym, imports)
+		if expr == "" {
+			if ok {
+				t.Errorf("%s should not be referenced: %+v", sym, r)
+			}
+			continue
+		}
+		if !ok || r.expr != expr {
+			t.Errorf("%s expected %s got %+v", sym, expr, r)
+		}
+	}
+	refs := []reference{{pkg: "github.com/a/b", expr: "%s.V"}, {pkg: "gopkg.in/yaml.v3", expr: "%s.Marshal"}}
+	b := new(bytes.Buffer)
+	if err := render(b, "// header\n", "main", nil, refs, []string{"x.y"}, func(b *bytes.Buffer, exprs []string) {
+		b.WriteString("var _ = []any{" + strings.Join(exprs, ",") + "}\n")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `p1 "gopkg.in/yaml.v3"`) || !strings.Contains(b.String(), "p0.V, p1.Marshal") {
+		t.Fatal(b.String())
+	}
+}
+
+func TestGenerateModuleTypes(t *testing.T) {
+	dir := t.TempDir()
+	src := "package sample\n\nimport (\n\t\"bytes\"\n\t\"container/ring\"\n)\n\n" +
+		"func Ring() any {\n\treturn new(ring.Ring)\n}\n\nfunc Buffer() any {\n\treturn new(bytes.Buffer)\n}\n"
+	if err := os.WriteFile(filepath.Join(dir, "types.go"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := (&Builder{Dir: dir}).Compile(context.Background(), []string{"types.go"})
+	if err != nil {
+		t.Fatal(err, r.Diagnostics)
+	}
+	file := filepath.Join(dir, r.Name)
+	if err = r.Write(file); err != nil {
+		t.Fatal(err)
+	}
+	host, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := new(bytes.Buffer)
+	if _, err = GenerateModuleTypes(b, host, "host", ModuleFile{File: file, PkgPath: "sample"}); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	if !strings.Contains(out, "package host") || !strings.Contains(out, "func RegisterModuleTypes(sym dynamic.Symbols)") {
+		t.Fatal(out)
+	}
+	// ring is not linked into the host, which is the test binary, bytes is
+	if !strings.Contains(out, `"container/ring"`) || !strings.Contains(out, ".Ring)(nil)") || strings.Contains(out, `"bytes"`) {
+		t.Fatal(out)
+	}
+}
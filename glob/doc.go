@@ -1,4 +1,6 @@
 /*
-Package glob provide a global Sym pool for use dynamic
+Package glob provide a global Sym pool for use dynamic.
+
+The package level functions operate on the [Default] registry, which is created on first use, scoped registries can be created by [Registry.Child].
 */
 package glob
@@ -2,21 +2,31 @@ package glob
 
 import (
 	"errors"
+	"sync"
+
 	"github.com/ZenLiuCN/dynamic"
 	"github.com/ZenLiuCN/fn"
-	"github.com/pkujhd/goloader"
-	"maps"
-	"os"
 )
 
 var (
-	gob     map[string]uintptr
-	modules map[string]dynamic.Dynamic
+	defaultOnce     sync.Once
+	defaultRegistry *Registry
+	defaultErr      error
 )
 
-func init() {
-	gob = make(map[string]uintptr)
-	fn.Panic(goloader.RegSymbol(gob))
+// Default returns the registry used by package level functions. It's created on first use rather than on package
+// initialization, so [dynamic.SetHostSymbolsCache] called before takes effect. It panics if the host symbols can't
+// be resolved, package level functions returning an error report it instead.
+func Default() *Registry {
+	return fn.Panic1(global())
+}
+
+// global returns the default registry, created on first call.
+func global() (*Registry, error) {
+	defaultOnce.Do(func() {
+		defaultRegistry, defaultErr = NewRegistry()
+	})
+	return defaultRegistry, defaultErr
 }
 
 var (
@@ -26,133 +36,108 @@ var (
 	ErrNotExists = errors.New("not registered into global")
 )
 
-// NewSymbols clone of global symbols
+// NewSymbols create a copy of global symbols
+//
+// Deprecated: it copies all symbols, use Default().NewSymbols to create a layer on global symbols instead.
 func NewSymbols() dynamic.Symbols {
-	return maps.Clone(gob)
+	return Default().Symbols()
 }
 
 // UseGlobalSo register symbols form a golang dynamic library (.so)
 func UseGlobalSo(p string) error {
-	return goloader.RegSymbolWithSo(gob, p)
+	r, err := global()
+	if err != nil {
+		return err
+	}
+	return r.UseSo(p)
 }
 
 // UseGlobalExecute register symbols form a go executable, those symbols can't be linked,
 // this function should only be use for testing dependencies.
 func UseGlobalExecute(p string) error {
-	return goloader.RegSymbolWithPath(gob, p)
+	r, err := global()
+	if err != nil {
+		return err
+	}
+	return r.UseExecute(p)
 }
 
 // UseGlobalTypes register types as global dependencies.
 func UseGlobalTypes(p ...any) {
-	goloader.RegTypes(gob, p...)
+	Default().UseTypes(p...)
 }
 
 // UseGlobalObject load a relocatable object file  and register to global dependencies.
 func UseGlobalObject(file string, pkg string) (err error) {
-	if _, ok := modules[file]; ok {
-		return ErrAlreadyExists
-	}
-	n := dynamic.NewDynamic(gob)
-	err = n.Initialize(file, pkg)
-	if err != nil {
-		return err
-	}
-	err = n.Link()
-	if err != nil {
-		return err
+	var r *Registry
+	if r, err = global(); err != nil {
+		return
 	}
-	modules[file] = n
-	register(n)
-	return
+	return r.UseObject(file, pkg)
 }
 
 // UseGlobalLinker load a serialized linker and register to global dependencies.
 func UseGlobalLinker(file string) (err error) {
-	if _, ok := modules[file]; ok {
-		return ErrAlreadyExists
-	}
-	n := dynamic.NewDynamic(gob)
-	var f *os.File
-	f, err = os.OpenFile(file, os.O_WRONLY, os.ModePerm)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	err = n.InitializeSerialized(f)
-	if err != nil {
-		return err
-	}
-	err = n.Link()
-	if err != nil {
-		return err
+	var r *Registry
+	if r, err = global(); err != nil {
+		return
 	}
-	modules[file] = n
-	register(n)
-	return
+	return r.UseLinker(file)
 }
 
 // GlobalDynamics returns a copy map of global shared dynamics. should not modify any data. the result is map[FilePath|ModuleName] Dynamic
-func GlobalDynamics() (v map[string]dynamic.Dynamic) {
-	return maps.Clone(modules)
+func GlobalDynamics() (v map[string]*dynamic.Dynamic) {
+	return Default().Dynamics()
 }
 
 // GlobalSymbols returns a copy of global symbols
 func GlobalSymbols() (v map[string]uintptr) {
-	v = make(map[string]uintptr, len(gob))
-	for s, d := range gob {
-		v[s] = d
-	}
-	return
+	return Default().Symbols()
 }
 
-// CloseGlobalDynamics close all global dynamics and reload runtime symbols. this should only use when all Dynamics are free!
+// CloseGlobalDynamics close all global dynamics and unregister their symbols. this should only use when all Dynamics are free!
 func CloseGlobalDynamics() error {
-	for k, d := range modules {
-		unregister(d)
-		d.Free(true)
-		delete(modules, k)
+	r, err := global()
+	if err != nil {
+		return err
 	}
-	return goloader.RegSymbol(gob)
+	return r.Close()
 }
 
 // RegisterGlobalDynamic register an user Dynamic into global dependencies. name must be unique
-func RegisterGlobalDynamic(name string, d dynamic.Dynamic) error {
-	if _, ok := modules[name]; ok {
-		return ErrAlreadyExists
+func RegisterGlobalDynamic(name string, d *dynamic.Dynamic) error {
+	r, err := global()
+	if err != nil {
+		return err
 	}
-	modules[name] = d
-	register(d)
-	return nil
+	return r.Register(name, d)
 }
 
 // UnregisterGlobalDynamic unregister an user Dynamic by register name from global dependencies.
 func UnregisterGlobalDynamic(name string) error {
-	if d, ok := modules[name]; !ok {
-		return ErrNotExists
-	} else {
-		unregister(d)
-		delete(modules, name)
+	r, err := global()
+	if err != nil {
+		return err
 	}
-	return nil
+	return r.Unregister(name)
 }
 
-func register(d dynamic.Dynamic) {
-	if d.GetModule() == nil {
-		return
-	}
-	for s, u := range d.GetModule().Syms {
-		if _, ok := gob[s]; !ok {
-			gob[s] = u
-		}
-	}
+// SetConflictPolicy set the policy of symbols conflict for later global registrations.
+func SetConflictPolicy(policy dynamic.ConflictPolicy) {
+	Default().SetConflictPolicy(policy)
 }
-func unregister(d dynamic.Dynamic) {
-	if d.GetModule() == nil {
-		return
-	}
-	for s, u := range d.GetModule().Syms {
-		if x, ok := gob[s]; ok && x == u {
-			delete(gob, s)
-		}
-	}
+
+// Conflicts returns all symbol conflicts seen by global registrations.
+func Conflicts() []dynamic.Conflict {
+	return Default().Conflicts()
+}
+
+// Subscribe register a listener of global dynamics lifecycle events.
+func Subscribe(l dynamic.Listener) (cancel func()) {
+	return Default().Subscribe(l)
+}
+
+// Events subscribe global dynamics lifecycle events into a buffered channel, see [dynamic.Events.Channel].
+func Events(size int) (ch <-chan dynamic.Event, cancel func()) {
+	return Default().Events(size)
 }
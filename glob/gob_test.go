@@ -0,0 +1,30 @@
+package glob
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/ZenLiuCN/dynamic"
+)
+
+func TestDefaultHostSymbolsCache(t *testing.T) {
+	// run in a fresh process, as the host symbols are resolved only once
+	if dir := os.Getenv("GLOB_HOST_SYMBOLS_CACHE"); dir != "" {
+		dynamic.SetHostSymbolsCache(dir)
+		if _, err := global(); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestDefaultHostSymbolsCache$")
+	cmd.Env = append(os.Environ(), "GLOB_HOST_SYMBOLS_CACHE="+dir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatal(err, string(out))
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "host-*.symbols")); len(files) != 1 {
+		t.Fatalf("cache not used: %v", files)
+	}
+}
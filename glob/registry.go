@@ -0,0 +1,317 @@
+package glob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"maps"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ZenLiuCN/dynamic"
+	"github.com/pkujhd/goloader"
+)
+
+// Registry is a pool of global symbols and dynamics, it's safe for concurrent use.
+//
+// A child Registry inherits symbols and dynamics of its parent, while its own additions are invisible to the parent
+// and siblings.
+type Registry struct {
+	parent    *Registry
+	mu        sync.RWMutex
+	symbols   *dynamic.SymbolLayer // layer of own symbols, forked from the parent or host symbols
+	modules   map[string]*dynamic.Dynamic
+	hashes    map[string]string // content hash of dynamics loaded from files
+	events    dynamic.Events
+	registrar dynamic.Registrar
+	pending   []dynamic.Event // events deliver after unlock
+}
+
+// NewRegistry create a root Registry with symbols of the running executable.
+func NewRegistry() (r *Registry, err error) {
+	r = &Registry{modules: make(map[string]*dynamic.Dynamic), hashes: make(map[string]string)}
+	r.symbols, err = dynamic.NewSymbolLayer()
+	return
+}
+
+// Child create a child Registry.
+func (r *Registry) Child() *Registry {
+	return &Registry{parent: r, symbols: r.symbols.Fork(), modules: make(map[string]*dynamic.Dynamic), hashes: make(map[string]string)}
+}
+
+// Parent returns parent of a child Registry, nil for root.
+func (r *Registry) Parent() *Registry {
+	return r.parent
+}
+
+// NewSymbols create a layer on symbols visible to the registry.
+func (r *Registry) NewSymbols() *dynamic.SymbolLayer {
+	return r.symbols.Fork()
+}
+
+// Symbols returns a copy of symbols visible to the registry.
+func (r *Registry) Symbols() map[string]uintptr {
+	return r.symbols.Map()
+}
+
+// Dynamics returns a copy of dynamics visible to the registry, keyed by file path or registered name.
+func (r *Registry) Dynamics() map[string]*dynamic.Dynamic {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.parent == nil {
+		return maps.Clone(r.modules)
+	}
+	v := r.parent.Dynamics()
+	maps.Copy(v, r.modules)
+	return v
+}
+
+func (r *Registry) exists(name string) bool {
+	if _, ok := r.modules[name]; ok {
+		return true
+	}
+	return r.parent != nil && r.parent.Exists(name)
+}
+
+// Exists check if a dynamic registered with the name visible to the registry.
+func (r *Registry) Exists(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.exists(name)
+}
+
+// UseSo register symbols form a golang dynamic library (.so)
+func (r *Registry) UseSo(p string) error {
+	return r.symbols.Update(func(own map[string]uintptr) error {
+		return goloader.RegSymbolWithSo(own, p)
+	})
+}
+
+// UseExecute register symbols form a go executable, those symbols can't be linked,
+// this function should only be use for testing dependencies.
+func (r *Registry) UseExecute(p string) error {
+	return r.symbols.Update(func(own map[string]uintptr) error {
+		return goloader.RegSymbolWithPath(own, p)
+	})
+}
+
+// UseTypes register types as dependencies.
+func (r *Registry) UseTypes(p ...any) {
+	_ = r.symbols.Update(func(own map[string]uintptr) error {
+		goloader.RegTypes(own, p...)
+		return nil
+	})
+}
+
+// UseObject load a relocatable object file and register it.
+func (r *Registry) UseObject(file string, pkg string) (err error) {
+	r.mu.Lock()
+	defer r.unlock()
+	if r.exists(file) {
+		return ErrAlreadyExists
+	}
+	e := dynamic.Event{PkgPath: pkg, Source: file, Hash: hashFile(file)}
+	n := dynamic.NewDynamic(r.symbols)
+	t := time.Now()
+	err = n.Initialize(file, pkg)
+	if err != nil {
+		r.emit(e, dynamic.EventFailed, t, err)
+		return err
+	}
+	r.emit(e, dynamic.EventInitialized, t, nil)
+	t = time.Now()
+	err = n.Link()
+	if err != nil {
+		r.emit(e, dynamic.EventFailed, t, err)
+		return err
+	}
+	if err = r.register(file, e.Hash, n); err != nil {
+		r.emit(e, dynamic.EventFailed, t, err)
+		n.Free(false)
+		return err
+	}
+	r.emit(e, dynamic.EventLinked, t, nil)
+	r.modules[file] = n
+	r.hashes[file] = e.Hash
+	return
+}
+
+// UseLinker load a serialized linker and register it.
+func (r *Registry) UseLinker(file string) (err error) {
+	r.mu.Lock()
+	defer r.unlock()
+	if r.exists(file) {
+		return ErrAlreadyExists
+	}
+	h := hashFile(file)
+	n := dynamic.NewDynamic(r.symbols)
+	var f *os.File
+	f, err = os.Open(file)
+	if err != nil {
+		r.emit(dynamic.Event{Source: file}, dynamic.EventFailed, time.Time{}, err)
+		return err
+	}
+	defer f.Close()
+	t := time.Now()
+	err = n.InitializeSerialized(f)
+	if err != nil {
+		r.emitPackages(n, dynamic.EventFailed, file, h, t, err)
+		return err
+	}
+	r.emitPackages(n, dynamic.EventInitialized, file, h, t, nil)
+	t = time.Now()
+	err = n.Link()
+	if err != nil {
+		r.emitPackages(n, dynamic.EventFailed, file, h, t, err)
+		return err
+	}
+	if err = r.register(file, h, n); err != nil {
+		r.emitPackages(n, dynamic.EventFailed, file, h, t, err)
+		n.Free(false)
+		return err
+	}
+	r.emitPackages(n, dynamic.EventLinked, file, h, t, nil)
+	r.modules[file] = n
+	r.hashes[file] = h
+	return
+}
+
+// Close all dynamics of the registry. This should only use when all Dynamics are free!
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	defer r.unlock()
+	var errs []error
+	for k, d := range r.modules {
+		errs = append(errs, r.unregister(k, d))
+		r.emitPackages(d, dynamic.EventUnloaded, k, r.hashes[k], time.Time{}, nil)
+		d.Free(true)
+		delete(r.modules, k)
+		delete(r.hashes, k)
+	}
+	return errors.Join(errs...)
+}
+
+// Register an user Dynamic. name must be unique in the registry and its parents.
+func (r *Registry) Register(name string, d *dynamic.Dynamic) error {
+	r.mu.Lock()
+	defer r.unlock()
+	if r.exists(name) {
+		return ErrAlreadyExists
+	}
+	if err := r.register(name, "", d); err != nil {
+		return err
+	}
+	r.modules[name] = d
+	r.emitPackages(d, dynamic.EventLinked, name, "", time.Time{}, nil)
+	return nil
+}
+
+// Unregister an user Dynamic by register name, dynamics of parents can't be unregistered by a child.
+func (r *Registry) Unregister(name string) error {
+	r.mu.Lock()
+	defer r.unlock()
+	d, ok := r.modules[name]
+	if !ok {
+		return ErrNotExists
+	}
+	err := r.unregister(name, d)
+	r.emitPackages(d, dynamic.EventUnloaded, name, r.hashes[name], time.Time{}, nil)
+	delete(r.modules, name)
+	delete(r.hashes, name)
+	return err
+}
+
+// SetConflictPolicy set the policy of symbols conflict for later registrations.
+func (r *Registry) SetConflictPolicy(policy dynamic.ConflictPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.registrar.Policy = policy
+}
+
+// Conflicts returns all symbol conflicts seen by registrations of the registry.
+func (r *Registry) Conflicts() []dynamic.Conflict {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.registrar.Conflicts()
+}
+
+// Subscribe register a listener of lifecycle events of the registry.
+func (r *Registry) Subscribe(l dynamic.Listener) (cancel func()) {
+	return r.events.Subscribe(l)
+}
+
+// Events subscribe lifecycle events of the registry into a buffered channel, see [dynamic.Events.Channel].
+func (r *Registry) Events(size int) (ch <-chan dynamic.Event, cancel func()) {
+	return r.events.Channel(size)
+}
+
+// register symbols of the dynamic, under ConflictError the dynamic is rejected without any registration.
+func (r *Registry) register(name, hash string, d *dynamic.Dynamic) error {
+	if d.GetModule() == nil {
+		return nil
+	}
+	if err := r.registrar.CheckError(r.symbols, name, d.GetModule().Syms, nil); err != nil {
+		return err
+	}
+	v, err := r.registrar.Register(r.symbols, name, d.GetModule().Syms, nil)
+	for _, c := range v {
+		r.pending = append(r.pending, dynamic.Event{Kind: dynamic.EventConflict, PkgPath: packageOf(d, c.Symbol),
+			Source: name, Hash: hash, Symbol: c.Symbol})
+	}
+	return err
+}
+
+// packageOf find the package of the dynamic a symbol belongs to, empty for none.
+func packageOf(d *dynamic.Dynamic, sym string) (pkg string) {
+	for p := range d.GetLinker().Packages {
+		if strings.HasPrefix(sym, p+".") && len(p) > len(pkg) {
+			pkg = p
+		}
+	}
+	return
+}
+func (r *Registry) unregister(name string, d *dynamic.Dynamic) error {
+	if d.GetModule() == nil {
+		return nil
+	}
+	return r.registrar.Unregister(r.symbols, name, d.GetModule().Syms, nil)
+}
+
+func (r *Registry) emit(e dynamic.Event, kind dynamic.EventKind, t time.Time, err error) {
+	e.Kind = kind
+	e.Err = err
+	if !t.IsZero() {
+		e.Duration = time.Since(t)
+	}
+	r.pending = append(r.pending, e)
+}
+
+// unlock release the write lock then deliver pending events.
+func (r *Registry) unlock() {
+	e := r.pending
+	r.pending = nil
+	r.mu.Unlock()
+	r.events.Emit(e...)
+}
+
+// emitPackages emit an event for each package of the dynamic, hash is empty for user dynamics.
+func (r *Registry) emitPackages(d *dynamic.Dynamic, kind dynamic.EventKind, source, hash string, t time.Time, err error) {
+	if d.GetLinker() == nil {
+		r.emit(dynamic.Event{Source: source, Hash: hash}, kind, t, err)
+		return
+	}
+	for p := range d.GetLinker().Packages {
+		r.emit(dynamic.Event{PkgPath: p, Source: source, Hash: hash}, kind, t, err)
+	}
+}
+
+func hashFile(file string) string {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,116 @@
+package glob
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/ZenLiuCN/dynamic"
+	"github.com/ZenLiuCN/fn"
+)
+
+func TestConflictPolicy(t *testing.T) {
+	const file = "../testdata/func.o"
+	for _, policy := range []dynamic.ConflictPolicy{dynamic.ConflictFirstWins, dynamic.ConflictError, dynamic.ConflictLastWins, dynamic.ConflictPrefix} {
+		t.Run(policy.String(), func(t *testing.T) {
+			r := fn.Panic1(NewRegistry())
+			r.SetConflictPolicy(policy)
+			fn.Panic(r.symbols.Store("other.Run", 1))
+			var conflicts []dynamic.Event
+			r.Subscribe(func(e dynamic.Event) {
+				if e.Kind == dynamic.EventConflict {
+					conflicts = append(conflicts, e)
+				}
+			})
+			err := r.UseObject(file, "other")
+			if policy == dynamic.ConflictError {
+				if !errors.Is(err, dynamic.ErrConflict) || r.Exists(file) {
+					t.Fatalf("expect rejected by ErrConflict, got %v", err)
+				}
+				return
+			}
+			fn.Panic(err)
+			if c := r.Conflicts(); len(c) != 1 || c[0].Symbol != "other.Run" || c[0].Existing != "host" {
+				t.Fatalf("conflicts %v", c)
+			}
+			if len(conflicts) != 1 || conflicts[0].PkgPath != "other" || conflicts[0].Hash == "" {
+				t.Fatalf("conflict events %+v", conflicts)
+			}
+			u, _ := r.symbols.Lookup("other.Run")
+			switch policy {
+			case dynamic.ConflictFirstWins:
+				if u != 1 {
+					t.Fatalf("registered symbol should be kept, got %x", u)
+				}
+			case dynamic.ConflictLastWins:
+				if u == 1 {
+					t.Fatal("registered symbol should be overridden")
+				}
+				fn.Panic(r.Unregister(file))
+				if u, _ = r.symbols.Lookup("other.Run"); u != 1 {
+					t.Fatalf("overridden symbol should be restored, got %x", u)
+				}
+			case dynamic.ConflictPrefix:
+				if _, ok := r.symbols.Lookup(file + ":other.Run"); u != 1 || !ok {
+					t.Fatal("new symbol should be registered with prefix")
+				}
+			}
+		})
+	}
+}
+
+func TestChildIsolation(t *testing.T) {
+	r := fn.Panic1(NewRegistry())
+	a, b := r.Child(), r.Child()
+	fn.Panic(r.symbols.Store("p.Run", 1))
+	fn.Panic(a.symbols.Store("a.Run", 2))
+	fn.Panic(r.Register("p", dynamic.NewDynamic(r.NewSymbols())))
+	fn.Panic(a.Register("a", dynamic.NewDynamic(a.NewSymbols())))
+	if _, ok := a.Symbols()["p.Run"]; !ok || !a.Exists("p") {
+		t.Fatal("child should inherit parent")
+	}
+	if _, ok := r.Symbols()["a.Run"]; ok || r.Exists("a") {
+		t.Fatal("child additions leaked into parent")
+	}
+	if _, ok := b.Symbols()["a.Run"]; ok || b.Exists("a") {
+		t.Fatal("child additions leaked into sibling")
+	}
+	if err := a.Unregister("p"); !errors.Is(err, ErrNotExists) {
+		t.Fatalf("child should not unregister dynamics of parent, got %v", err)
+	}
+	if err := b.Register("p", dynamic.NewDynamic(b.NewSymbols())); !errors.Is(err, ErrAlreadyExists) {
+		t.Fatalf("name registered by parent should be taken, got %v", err)
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	r := fn.Panic1(NewRegistry())
+	var wg sync.WaitGroup
+	for i := range 8 {
+		c := r.Child()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 50 {
+				name := fmt.Sprintf("m%d.%d", i, j)
+				fn.Panic(r.symbols.Store(name, uintptr(j+1)))
+				fn.Panic(r.Register(name, dynamic.NewDynamic(r.NewSymbols())))
+				fn.Panic(c.Register(name+"c", dynamic.NewDynamic(c.NewSymbols())))
+				if !c.Exists(name) {
+					t.Errorf("%s should be visible to child", name)
+				}
+				if u, ok := c.NewSymbols().Lookup(name); !ok || u != uintptr(j+1) {
+					t.Errorf("%s should be resolved by child", name)
+				}
+				_ = r.Dynamics()
+				_ = c.Symbols()
+				fn.Panic(c.Unregister(name + "c"))
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(r.Dynamics()); n != 8*50 {
+		t.Fatalf("registered %d dynamics", n)
+	}
+}
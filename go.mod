@@ -8,6 +8,7 @@ require (
 	github.com/ZenLiuCN/fn v0.1.35
 	github.com/pkujhd/goloader v0.0.21
 	github.com/urfave/cli/v3 v3.4.1
+	golang.org/x/mod v0.28.0
 )
 
 require (
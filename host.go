@@ -0,0 +1,218 @@
+package dynamic
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"unsafe"
+
+	"github.com/ZenLiuCN/fn"
+	"github.com/pkujhd/goloader"
+)
+
+var (
+	host      *SymbolLayer
+	hostErr   error
+	hostOnce  sync.Once
+	hostMu    sync.Mutex
+	hostCache string
+	// executable locates the running executable, replaced by tests.
+	executable = os.Executable
+)
+
+// ErrMissingBuildID occurs when the executable has no go build ID.
+var ErrMissingBuildID = errors.New("missing go build id")
+
+// SetHostSymbolsCache enable caching the host symbols into a directory, it must be called before the first use of
+// [HostSymbols] or [NewSymbolLayer].
+//
+// The cache file is named by the executable path and keyed by its go build ID, it's rebuilt when the build ID changes.
+// When the cache can't be used, such as the executable built without a build ID, symbols are resolved without cache.
+func SetHostSymbolsCache(dir string) {
+	hostMu.Lock()
+	defer hostMu.Unlock()
+	hostCache = dir
+}
+
+// HostSymbols returns the immutable symbols of the running executable, it's resolved only once.
+func HostSymbols() (*SymbolLayer, error) {
+	hostOnce.Do(func() {
+		var m map[string]uintptr
+		if m, hostErr = hostSymbols(); hostErr != nil {
+			return
+		}
+		host = &SymbolLayer{own: m, frozen: true}
+	})
+	return host, hostErr
+}
+
+func hostSymbols() (m map[string]uintptr, err error) {
+	hostMu.Lock()
+	dir := hostCache
+	hostMu.Unlock()
+	if dir != "" {
+		var exe string
+		if exe, err = executable(); err == nil {
+			if m, err = cachedSymbols(dir, exe); err == nil {
+				return
+			}
+		}
+		log.Printf("resolve host symbols without cache: %v", err)
+	}
+	m = make(map[string]uintptr)
+	err = goloader.RegSymbol(m)
+	return
+}
+
+// cachedSymbols read symbols of the executable from the cache in dir, the cache is rebuilt when the build ID changes.
+func cachedSymbols(dir, exe string) (m map[string]uintptr, err error) {
+	var id string
+	if id, err = BuildID(exe); err != nil {
+		return
+	}
+	h := sha256.Sum256([]byte(exe))
+	file := filepath.Join(dir, "host-"+hex.EncodeToString(h[:8])+".symbols")
+	if m, err = readHostCache(file, exe, id); err == nil {
+		return
+	}
+	m = make(map[string]uintptr)
+	if err = goloader.RegSymbol(m); err != nil {
+		return
+	}
+	if e := writeHostCache(file, exe, id, m); e != nil {
+		log.Printf("write host symbols cache %s: %v", file, e)
+	}
+	return
+}
+
+// hostCacheFile is the content of a host symbols cache.
+type hostCacheFile struct {
+	Path    string
+	BuildID string
+	Offsets map[string]int64 // offset to the anchor address, addresses are randomized between runs
+}
+
+// anchor is the address all offsets relative to, same as goloader used for ASLR.
+func anchor() int64 {
+	return int64(uintptr(unsafe.Pointer(&os.Stdout)))
+}
+
+func readHostCache(file, exe, id string) (m map[string]uintptr, err error) {
+	var f *os.File
+	if f, err = os.Open(file); err != nil {
+		return
+	}
+	defer fn.IgnoreClose(f)
+	var c hostCacheFile
+	if err = gob.NewDecoder(f).Decode(&c); err != nil {
+		return
+	}
+	if c.Path != exe || c.BuildID != id {
+		return nil, fmt.Errorf("stale host symbols cache of %s@%s", c.Path, c.BuildID)
+	}
+	a := anchor()
+	m = make(map[string]uintptr, len(c.Offsets))
+	for s, o := range c.Offsets {
+		m[s] = uintptr(a + o)
+	}
+	return
+}
+
+func writeHostCache(file, exe, id string, m map[string]uintptr) (err error) {
+	if err = os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return
+	}
+	a := anchor()
+	c := hostCacheFile{Path: exe, BuildID: id, Offsets: make(map[string]int64, len(m))}
+	for s, u := range m {
+		c.Offsets[s] = int64(u) - a
+	}
+	var f *os.File
+	if f, err = os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*"); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+	if err = gob.NewEncoder(f).Encode(&c); err != nil {
+		_ = f.Close()
+		return
+	}
+	if err = f.Close(); err != nil {
+		return
+	}
+	return os.Rename(f.Name(), file)
+}
+
+var (
+	buildIDPrefix = []byte("\xff Go build ID: \"")
+	buildIDSuffix = []byte("\"\n \xff")
+	elfGoNote     = []byte("Go\x00\x00")
+)
+
+const (
+	elfGoBuildIDTag = 4
+	buildIDSearch   = 32 * 1024
+)
+
+// BuildID read the go build ID of an executable.
+func BuildID(file string) (id string, err error) {
+	var f *os.File
+	if f, err = os.Open(file); err != nil {
+		return
+	}
+	defer fn.IgnoreClose(f)
+	if e, x := elf.NewFile(f); x == nil {
+		if s := e.Section(".note.go.buildid"); s != nil {
+			var b []byte
+			if b, err = s.Data(); err != nil {
+				return
+			}
+			if id = elfNote(b, e.ByteOrder); id != "" {
+				return
+			}
+		}
+	}
+	b := make([]byte, buildIDSearch)
+	var n int
+	if n, err = io.ReadFull(f, b); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return
+	}
+	err = nil
+	b = b[:n]
+	i := bytes.Index(b, buildIDPrefix)
+	if i < 0 {
+		return "", ErrMissingBuildID
+	}
+	b = b[i+len(buildIDPrefix):]
+	if i = bytes.Index(b, buildIDSuffix); i < 0 {
+		return "", ErrMissingBuildID
+	}
+	return string(b[:i]), nil
+}
+
+func elfNote(b []byte, order binary.ByteOrder) string {
+	if len(b) < 16 {
+		return ""
+	}
+	nameSize, descSize, tag := order.Uint32(b), order.Uint32(b[4:]), order.Uint32(b[8:])
+	if nameSize != uint32(len(elfGoNote)) || tag != elfGoBuildIDTag || !bytes.Equal(b[12:16], elfGoNote) {
+		return ""
+	}
+	if uint32(len(b)) < 16+descSize {
+		return ""
+	}
+	return string(b[16 : 16+descSize])
+}
@@ -0,0 +1,74 @@
+package dynamic
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestBuildID(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := BuildID(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == "" {
+		t.Fatal("empty build id")
+	}
+	file := filepath.Join(t.TempDir(), "host.symbols")
+	m := map[string]uintptr{"a": uintptr(anchor()) + 16, "b": uintptr(anchor()) - 16}
+	if err = writeHostCache(file, exe, id, m); err != nil {
+		t.Fatal(err)
+	}
+	v, err := readHostCache(file, exe, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v["a"] != m["a"] || v["b"] != m["b"] {
+		t.Fatalf("mismatch cache: %v", v)
+	}
+	if _, err = readHostCache(file, exe, id+"x"); err == nil {
+		t.Fatal("should invalidate on build id changed")
+	}
+}
+
+func TestHostSymbolsCache(t *testing.T) {
+	dir := t.TempDir()
+	SetHostSymbolsCache(dir)
+	defer func() {
+		SetHostSymbolsCache("")
+		executable = os.Executable
+	}()
+	reset := func() {
+		hostOnce, host, hostErr = sync.Once{}, nil, nil
+	}
+	reset()
+	h, err := HostSymbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "host-*.symbols"))
+	if len(files) != 1 {
+		t.Fatalf("cache not written: %v", files)
+	}
+	reset()
+	c, err := HostSymbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(h.Map(), c.Map()) {
+		t.Fatal("cached symbols mismatch")
+	}
+	executable = func() (string, error) {
+		return "testdata/func.go", nil
+	}
+	reset()
+	if _, err = HostSymbols(); err != nil {
+		t.Fatalf("should resolve without cache for executable without build id: %v", err)
+	}
+}
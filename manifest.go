@@ -0,0 +1,73 @@
+package dynamic
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Manifest declares layers a module requires, it's stored beside the module file, see [ManifestFile].
+//
+// A layer is a linkable of dependency packages shared by modules, which should be loaded once before modules
+// require it.
+type Manifest struct {
+	Requires []string `json:"requires"` // layer files, relative to the directory of module file
+}
+
+// ManifestFile returns the manifest file path of a module file.
+func ManifestFile(module string) string {
+	return module + ".json"
+}
+
+// ReadManifest read manifest of a module file, returns nil without error if not exists.
+// Required layers are resolved as paths relative to the module file.
+func ReadManifest(module string) (m *Manifest, err error) {
+	var b []byte
+	if b, err = os.ReadFile(ManifestFile(module)); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return
+	}
+	m = new(Manifest)
+	if err = json.Unmarshal(b, m); err != nil {
+		return nil, err
+	}
+	for i, r := range m.Requires {
+		if !filepath.IsAbs(r) {
+			m.Requires[i] = filepath.Join(filepath.Dir(module), r)
+		}
+	}
+	return
+}
+
+// WriteManifest write manifest of a module file requires layers, layers are recorded relative to the module file.
+// The manifest is removed if no layers required.
+func WriteManifest(module string, layers []string) (err error) {
+	if len(layers) == 0 {
+		if err = os.Remove(ManifestFile(module)); errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+	var dir string
+	if dir, err = filepath.Abs(filepath.Dir(module)); err != nil {
+		return
+	}
+	m := Manifest{Requires: make([]string, 0, len(layers))}
+	for _, l := range layers {
+		var r string
+		if r, err = filepath.Abs(l); err != nil {
+			return
+		}
+		if r, err = filepath.Rel(dir, r); err != nil {
+			return
+		}
+		m.Requires = append(m.Requires, filepath.ToSlash(r))
+	}
+	var b []byte
+	if b, err = json.MarshalIndent(m, "", "  "); err != nil {
+		return
+	}
+	return writeFile(ManifestFile(module), b)
+}
@@ -0,0 +1,34 @@
+package dynamic
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	module := filepath.Join(dir, "out", "feature.linkable")
+	if err := os.MkdirAll(filepath.Dir(module), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := ReadManifest(module); err != nil || m != nil {
+		t.Fatal(m, err)
+	}
+	if err := WriteManifest(module, []string{filepath.Join(dir, "shared.linkable")}); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ReadManifest(module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Requires) != 1 || m.Requires[0] != filepath.Join(dir, "shared.linkable") {
+		t.Fatal(m.Requires)
+	}
+	if err = WriteManifest(module, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(ManifestFile(module)); !os.IsNotExist(err) {
+		t.Fatal("manifest should be removed")
+	}
+}
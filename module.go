@@ -0,0 +1,235 @@
+package dynamic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/version"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// listed is a package reported by 'go list -json'.
+type listed struct {
+	ImportPath string
+	Dir        string
+	Export     string
+	Standard   bool
+	GoFiles    []string
+	CgoFiles   []string
+	EmbedFiles []string
+	SFiles     []string
+	Module     *struct {
+		Path      string
+		Dir       string
+		Main      bool
+		GoVersion string
+	}
+	Error *struct {
+		Err string
+	}
+}
+
+// local reports the package belongs to the main module.
+func (p *listed) local() bool {
+	return p.Module != nil && p.Module.Main
+}
+
+// flags returns flags of 'go tool compile' for the package, the language version is the go directive of its module.
+func (p *listed) flags() []string {
+	v := []string{"-p", p.ImportPath}
+	if p.Module != nil && p.Module.GoVersion != "" {
+		v = append(v, "-lang="+version.Lang("go"+p.Module.GoVersion))
+	}
+	return v
+}
+
+// PackModule compile all packages of the go module in Dir matched by patterns, default './...', in dependency order,
+// and pack them with dependencies into one linkable named by the module path.
+//
+// Packages use cgo, embed files or assembly are not supported. Sources are compiled with the language version of
+// the go directive of the module.
+func (b *Builder) PackModule(ctx context.Context, patterns []string, opt PackOptions) (r *BuildResult, err error) {
+	r = new(BuildResult)
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	err = b.build(r, func(tmp string) (err error) {
+		var pkgs []*listed
+		if pkgs, err = b.list(ctx, r, patterns); err != nil {
+			return
+		}
+		var key string
+		if key, err = b.moduleKey(ctx, r, pkgs, opt, patterns); err != nil || b.restore(key, r) {
+			return
+		}
+		i := slices.IndexFunc(pkgs, (*listed).local)
+		if i < 0 {
+			return fmt.Errorf("%w: no package of main module matched %v", ErrBuild, patterns)
+		}
+		// paths are trimmed from the module root, so sources are recorded as 'module/package/file.go' in any location
+		module := pkgs[i].Module
+		flags := b.Options.compile(module.Dir, module.Path, true)
+		cfg := new(bytes.Buffer)
+		var files, paths []string
+		for i, p := range pkgs {
+			if !p.local() {
+				if p.Export != "" {
+					_, _ = fmt.Fprintf(cfg, "packagefile %s=%s\n", p.ImportPath, p.Export)
+				}
+				continue
+			}
+			if len(p.CgoFiles) > 0 || len(p.EmbedFiles) > 0 || len(p.SFiles) > 0 {
+				r.Diagnostics = append(r.Diagnostics, Diagnostic{Step: "compile", File: p.Dir, Message: "cgo, embed or assembly is not supported"})
+				return fmt.Errorf("%w: unsupported package %s", ErrBuild, p.ImportPath)
+			}
+			ic := filepath.Join(tmp, "importcfg")
+			if err = os.WriteFile(ic, cfg.Bytes(), 0644); err != nil {
+				return
+			}
+			file := filepath.Join(tmp, strconv.Itoa(i)+".a")
+			args := slices.Concat([]string{"tool", "compile", "-importcfg", ic, "-pack"}, p.flags(), flags)
+			args = append(args, "-o", file)
+			for _, f := range p.GoFiles {
+				args = append(args, filepath.Join(p.Dir, f))
+			}
+			if _, err = b.run(ctx, r, "compile", args...); err != nil {
+				return
+			}
+			_, _ = fmt.Fprintf(cfg, "packagefile %s=%s\n", p.ImportPath, file)
+			files = append(files, file)
+			paths = append(paths, p.ImportPath)
+		}
+		var sym *SymbolLayer
+		if sym, err = b.symbols(ctx, r, opt); err != nil {
+			return
+		}
+		var deps map[string]string
+		if !opt.NoPkg {
+			if deps, err = opt.dependencies(cfg.Bytes(), sym); err != nil {
+				return
+			}
+			for _, p := range paths {
+				delete(deps, p)
+			}
+		}
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		if r.Data, err = b.pack(r, sym, files, paths, deps); err != nil {
+			return
+		}
+		r.Name = b.name(path.Base(module.Path), ".linkable")
+		r.Requires = opt.Layers
+		b.store(key, r)
+		return
+	})
+	return
+}
+
+// moduleKey is the cache key of a module, from export files of dependencies and sources of local packages.
+func (b *Builder) moduleKey(ctx context.Context, r *BuildResult, pkgs []*listed, opt PackOptions, patterns []string) (string, error) {
+	if b.Cache == nil {
+		return "", nil
+	}
+	cfg := new(bytes.Buffer)
+	var files []string
+	for _, p := range pkgs {
+		if p.local() {
+			_, _ = fmt.Fprintf(cfg, "package %s\n", p.ImportPath)
+			for _, f := range p.GoFiles {
+				files = append(files, filepath.Join(p.Dir, f))
+			}
+		} else if p.Export != "" {
+			_, _ = fmt.Fprintf(cfg, "packagefile %s=%s\n", p.ImportPath, p.Export)
+		}
+	}
+	return b.key(ctx, r, "module", cfg.Bytes(), files, opt, patterns...)
+}
+
+// list packages and dependencies matched by patterns in dependency order.
+func (b *Builder) list(ctx context.Context, r *BuildResult, patterns []string) (v []*listed, err error) {
+	var out []byte
+	args := append(append([]string{"list", "-deps", "-export", "-json"}, b.Options.list()...), patterns...)
+	if out, err = b.run(ctx, r, "list", args...); err != nil {
+		return
+	}
+	d := json.NewDecoder(bytes.NewReader(out))
+	var errs []error
+	for {
+		p := new(listed)
+		if err = d.Decode(p); errors.Is(err, io.EOF) {
+			return v, errors.Join(errs...)
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: parse go list: %w", ErrBuild, err)
+		}
+		if p.Error != nil {
+			r.Diagnostics = append(r.Diagnostics, Diagnostic{Step: "list", Message: strings.TrimSpace(p.Error.Err)})
+			errs = append(errs, fmt.Errorf("%w: %s", ErrBuild, p.ImportPath))
+		}
+		v = append(v, p)
+	}
+}
+
+// PackLayer pack packages matched by patterns and their dependencies into a linkable as a layer shared by modules,
+// see [PackOptions.Layers]. Packages skipped by a module pack, or must be provided by the host with
+// [PackOptions.Host], are excluded. Without Host, Includes and Excludes, all packages listed are candidates.
+func (b *Builder) PackLayer(ctx context.Context, name string, patterns []string, opt PackOptions) (r *BuildResult, err error) {
+	r = new(BuildResult)
+	err = b.build(r, func(tmp string) (err error) {
+		var pkgs []*listed
+		if pkgs, err = b.list(ctx, r, patterns); err != nil {
+			return
+		}
+		cfg := new(bytes.Buffer)
+		all := opt.Host == "" && len(opt.Includes) == 0 && len(opt.Excludes) == 0
+		for _, p := range pkgs {
+			if p.Export != "" {
+				_, _ = fmt.Fprintf(cfg, "packagefile %s=%s\n", p.ImportPath, p.Export)
+				if all {
+					opt.Includes = append(opt.Includes, p.ImportPath)
+				}
+			}
+		}
+		var sym *SymbolLayer
+		if sym, err = b.symbols(ctx, r, opt); err != nil {
+			return
+		}
+		var deps map[string]string
+		if deps, err = opt.dependencies(cfg.Bytes(), sym); err != nil {
+			return
+		}
+		var files, paths []string
+		for _, p := range pkgs {
+			if f, ok := deps[p.ImportPath]; ok {
+				files = append(files, f)
+				paths = append(paths, p.ImportPath)
+			}
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("%w: no package to pack matched %v", ErrBuild, patterns)
+		}
+		var key string
+		if key, err = b.key(ctx, r, "layer", cfg.Bytes(), nil, opt, name, strings.Join(paths, " ")); err != nil || b.restore(key, r) {
+			return
+		}
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		if r.Data, err = b.pack(r, sym, files, paths, nil); err != nil {
+			return
+		}
+		r.Name = b.name(name, ".linkable")
+		r.Requires = opt.Layers
+		b.store(key, r)
+		return
+	})
+	return
+}
@@ -0,0 +1,98 @@
+package dynamic
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// module write files of a go module into a temporary directory.
+func module(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for f, s := range files {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(f)), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, f), []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestBuilderList(t *testing.T) {
+	dir := module(t, map[string]string{
+		"go.mod":       "module example.com/m\n\ngo 1.22\n",
+		"m.go":         "package m\n\nimport \"example.com/m/sub\"\n\nvar X = sub.Y\n",
+		"sub/sub.go":   "package sub\n\nimport \"strings\"\n\nvar Y = strings.ToUpper(\"y\")\n",
+		"sub/other.go": "//go:build ignored\n\npackage sub\n",
+	})
+	r := new(BuildResult)
+	v, err := (&Builder{Dir: dir}).list(context.Background(), r, []string{"./..."})
+	if err != nil {
+		t.Fatal(err, r.Diagnostics)
+	}
+	var local []string
+	for _, p := range v {
+		if p.local() {
+			local = append(local, p.ImportPath)
+			if len(p.GoFiles) != 1 {
+				t.Fatalf("%s files %v", p.ImportPath, p.GoFiles)
+			}
+		} else if p.Export == "" && p.ImportPath != "unsafe" {
+			t.Fatalf("missing export of %s", p.ImportPath)
+		}
+	}
+	if len(local) != 2 || local[0] != "example.com/m/sub" || local[1] != "example.com/m" {
+		t.Fatal(local)
+	}
+}
+
+func TestPackModule(t *testing.T) {
+	r, err := (&Builder{Dir: filepath.Join("testdata", "module")}).PackModule(context.Background(), nil, PackOptions{NoPkg: true})
+	if err != nil {
+		t.Fatal(err, r.Diagnostics)
+	}
+	if r.Name != "module.linkable" {
+		t.Fatal(r.Name)
+	}
+	file := filepath.Join(t.TempDir(), r.Name)
+	if err = r.Write(file); err != nil {
+		t.Fatal(err)
+	}
+	pkgs, err := layerPackages(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(pkgs, "example.com/module") || !slices.Contains(pkgs, "example.com/module/sub") {
+		t.Fatal(pkgs)
+	}
+}
+
+func TestPackModuleCompile(t *testing.T) {
+	dir := module(t, map[string]string{
+		"go.mod":    "module example.com/m\n\ngo 1.22\n",
+		"m.go":      "package m\n\nfunc Add(a, b int) int\n",
+		"m_amd64.s": "#include \"textflag.h\"\n\nTEXT ·Add(SB),NOSPLIT,$0-24\n\tRET\n",
+		"m_arm64.s": "#include \"textflag.h\"\n\nTEXT ·Add(SB),NOSPLIT,$0-24\n\tRET\n",
+	})
+	if _, err := (&Builder{Dir: dir}).PackModule(context.Background(), nil, PackOptions{NoPkg: true}); !errors.Is(err, ErrBuild) {
+		t.Fatalf("should reject assembly: %v", err)
+	}
+	p := &listed{ImportPath: "example.com/m"}
+	if v := p.flags(); !slices.Equal(v, []string{"-p", "example.com/m"}) {
+		t.Fatal(v)
+	}
+	p.Module = &struct {
+		Path      string
+		Dir       string
+		Main      bool
+		GoVersion string
+	}{Path: "example.com/m", Main: true, GoVersion: "1.21.3"}
+	if v := p.flags(); !slices.Equal(v, []string{"-p", "example.com/m", "-lang=go1.21"}) {
+		t.Fatal(v)
+	}
+}
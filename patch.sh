@@ -1,10 +1,40 @@
 #!/bin/sh
+# write an overlay provides cmd/objfile as a mirror of cmd/internal, the go sdk is never modified.
+# directories of the mirror only exist in the overlay, so test the host with 'go test -vet=off'.
+# usage: patch.sh [--dir DIR] [clean]
+#   --dir DIR  directory of overlay files, same as 'compiler prepare --dir', default the user cache directory
+#              as DefaultSDKDir: $XDG_CACHE_HOME or ~/.cache on unix, ~/Library/Caches on macOS.
+GOROOT=$(go env GOROOT) || exit 1
+GOVERSION=$(go env GOVERSION) || exit 1
+if [ "$1" = "--dir" ]; then
+  [ -n "$2" ] || { echo "missing value of --dir" >&2; exit 1; }
+  BASE="$2"
+  shift 2
+elif [ "$(uname)" = "Darwin" ]; then
+  BASE="$HOME/Library/Caches/dynamic/sdk"
+else
+  BASE="${XDG_CACHE_HOME:-$HOME/.cache}/dynamic/sdk"
+fi
+DIR="$BASE/$GOVERSION"
 echo "Lookup $GOROOT"
+echo "Overlay directory $DIR"
 
-if  [ ! -d "$GOROOT/src/cmd/objfile" ]; then
-  cp -r $GOROOT/src/cmd/internal $GOROOT/src/cmd/objfile
-  echo patched go sdk
-else
-  rm -rf $GOROOT/src/cmd/objfile
-  echo cleaned go sdk
-fi
\ No newline at end of file
+if [ "$1" = "clean" ]; then
+  rm -rf "$DIR"
+  echo cleaned overlay of go sdk
+  exit 0
+fi
+
+mkdir -p "$DIR"
+SRC="$GOROOT/src/cmd/internal"
+{
+  echo '{"Replace":{'
+  find "$SRC" -type d -name testdata -prune -o -type f -print | awk -v src="$SRC" -v dst="$GOROOT/src/cmd/objfile" '
+    { if (NR > 1) printf ",\n"; printf "\"%s%s\":\"%s\"", dst, substr($0, length(src) + 1), $0 }
+    END { printf "\n" }'
+  echo '}}'
+} > "$DIR/overlay.json.tmp" && mv "$DIR/overlay.json.tmp" "$DIR/overlay.json"
+echo prepared overlay of go sdk, build host with:
+echo "  go build -overlay=$DIR/overlay.json"
+echo "test host with vet disabled, as mirror directories only exist in the overlay:"
+echo "  go test -vet=off -overlay=$DIR/overlay.json"
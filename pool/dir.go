@@ -0,0 +1,227 @@
+package pool
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	. "github.com/ZenLiuCN/dynamic"
+	"github.com/pkujhd/goloader"
+)
+
+var (
+	// ErrCycle occurs when modules import each other.
+	ErrCycle = errors.New("import cycle between modules")
+	// ErrUnresolvable occurs when a module imports a package provided by a module failed to load.
+	ErrUnresolvable = errors.New("unresolvable module")
+)
+
+// unit is a module file discovered in a directory.
+type unit struct {
+	file     string
+	key      Key      // only for object file
+	data     []byte   // only for linkable
+	requires []string // layers required, only for linkable
+	provides []string // package paths
+	imports  []string // package paths
+}
+
+// LoadDir load all modules in a directory, modules are ordered by their imports that providers load before consumers.
+//
+// Object files (.o) and go archives (.a) are named as their package path with an optional '@version' suffix,
+// escaped by [url.PathEscape] that '/' is written as '%2F', such as 'sample@v1.a' and 'github.com%2Fa%2Fb@v1.o',
+// see [Key.FileName]. Serialized linkers (.linkable) carry their package paths.
+//
+// Layers required by manifests of linkables are loaded on demand rather than as modules, see [Pool.LoadLayer].
+//
+// Loading continues when some modules fail, the returned error joins all failures, cycles are reported as
+// ErrCycle and modules depend on failed ones or cycles as ErrUnresolvable.
+func (p *Pool) LoadDir(dir string) (err error) {
+	var e []os.DirEntry
+	if e, err = os.ReadDir(dir); err != nil {
+		return
+	}
+	var units []*unit
+	var errs []error
+	for _, entry := range e {
+		if entry.IsDir() {
+			continue
+		}
+		var u *unit
+		if u, err = scan(filepath.Join(dir, entry.Name())); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if u != nil {
+			units = append(units, u)
+		}
+	}
+	var layers []string
+	for _, u := range units {
+		layers = append(layers, u.requires...)
+	}
+	units = slices.DeleteFunc(units, func(u *unit) bool {
+		f, _ := filepath.Abs(u.file)
+		return slices.Contains(layers, f)
+	})
+	ordered, cyclic, blocked := order(units)
+	for _, u := range cyclic {
+		errs = append(errs, fmt.Errorf("%w: %s", ErrCycle, u.file))
+	}
+	var failed []string
+	for _, u := range slices.Concat(cyclic, blocked) {
+		failed = append(failed, u.provides...)
+	}
+	for _, u := range slices.Concat(blocked, ordered) {
+		if i := slices.IndexFunc(u.imports, func(s string) bool {
+			return slices.Contains(failed, s)
+		}); i >= 0 {
+			failed = append(failed, u.provides...)
+			errs = append(errs, fmt.Errorf("%w: %s requires %s", ErrUnresolvable, u.file, u.imports[i]))
+			continue
+		}
+		if u.data == nil {
+			err = p.LoadFile(u.file, u.key.String())
+		} else {
+			err = p.loadUnit(u)
+		}
+		if err != nil {
+			failed = append(failed, u.provides...)
+			errs = append(errs, fmt.Errorf("load %s: %w", u.file, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// loadUnit load a linkable unit after layers it requires.
+func (p *Pool) loadUnit(u *unit) (err error) {
+	p.Lock()
+	defer p.unlock()
+	_, err = p.loadRequired(&source{Reader: bytes.NewReader(u.data), file: u.file}, []string{u.key.Version}, u.requires)
+	return
+}
+
+// scan read imports of a module file, returns nil for files not a module.
+func scan(file string) (u *unit, err error) {
+	ext := filepath.Ext(file)
+	switch ext {
+	case ".o", ".a":
+		var name string
+		if name, err = url.PathUnescape(strings.TrimSuffix(filepath.Base(file), ext)); err != nil {
+			return nil, fmt.Errorf("package path of %s: %w", file, err)
+		}
+		u = &unit{file: file, key: ParseKey(name)}
+		var info *Info
+		if err, info = ObjectImportsIter(file, u.key.PkgPath); err != nil {
+			return nil, fmt.Errorf("read imports of %s: %w", file, err)
+		}
+		u.provides = []string{u.key.PkgPath}
+		for pkg := range info.Imports {
+			u.imports = append(u.imports, pkg)
+		}
+	case ".linkable":
+		u = &unit{file: file}
+		if u.data, err = os.ReadFile(file); err != nil {
+			return nil, err
+		}
+		var m *Manifest
+		if m, err = ReadManifest(file); err != nil {
+			return nil, fmt.Errorf("read manifest of %s: %w", file, err)
+		}
+		if m != nil {
+			for _, r := range m.Requires {
+				if r, err = filepath.Abs(r); err != nil {
+					return nil, err
+				}
+				u.requires = append(u.requires, r)
+			}
+		}
+		var l *goloader.Linker
+		if l, err = goloader.UnSerialize(bytes.NewReader(u.data)); err != nil {
+			return nil, fmt.Errorf("read imports of %s: %w", file, err)
+		}
+		for _, info := range LinkerImportsIter(l) {
+			u.provides = append(u.provides, info.PkgPath)
+			for pkg := range info.Imports {
+				u.imports = append(u.imports, pkg)
+			}
+		}
+		u.imports = slices.DeleteFunc(u.imports, func(s string) bool {
+			return slices.Contains(u.provides, s)
+		})
+	default:
+		return
+	}
+	slices.Sort(u.imports)
+	u.imports = slices.Compact(u.imports)
+	return
+}
+
+// order sort units that providers are before consumers, units in cycles are returned as cyclic, and units depend
+// on cycles but not in any are returned as blocked. Imports not provided by any unit are ignored.
+func order(units []*unit) (ordered, cyclic, blocked []*unit) {
+	slices.SortFunc(units, func(a, b *unit) int {
+		return strings.Compare(a.file, b.file)
+	})
+	pending := make(map[*unit]int, len(units))
+	consumers := make(map[*unit][]*unit, len(units))
+	for _, u := range units {
+		for _, x := range units {
+			if x != u && slices.ContainsFunc(x.provides, func(s string) bool {
+				return slices.Contains(u.imports, s)
+			}) {
+				pending[u]++
+				consumers[x] = append(consumers[x], u)
+			}
+		}
+	}
+	var ready []*unit
+	for _, u := range units {
+		if pending[u] == 0 {
+			ready = append(ready, u)
+		}
+	}
+	for len(ready) > 0 {
+		u := ready[0]
+		ready = ready[1:]
+		ordered = append(ordered, u)
+		for _, c := range consumers[u] {
+			if pending[c]--; pending[c] == 0 {
+				ready = append(ready, c)
+			}
+		}
+	}
+	for _, u := range units {
+		switch {
+		case pending[u] == 0:
+		case reaches(consumers, u, u):
+			cyclic = append(cyclic, u)
+		default:
+			blocked = append(blocked, u)
+		}
+	}
+	return
+}
+
+// reaches check if a unit is consumed by the target directly or indirectly.
+func reaches(consumers map[*unit][]*unit, from, target *unit) bool {
+	seen := make(map[*unit]bool)
+	next := slices.Clone(consumers[from])
+	for len(next) > 0 {
+		u := next[0]
+		next = next[1:]
+		if u == target {
+			return true
+		}
+		if !seen[u] {
+			seen[u] = true
+			next = append(next, consumers[u]...)
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package pool
+
+import (
+	"errors"
+	"reflect"
+	"runtime"
+	"unsafe"
+)
+
+// ErrSignature occurs when a function symbol does not match the required function type.
+var ErrSignature = errors.New("signature mismatch")
+
+// ptrSize is the register size that argument frames are aligned to.
+const ptrSize = int(unsafe.Sizeof(uintptr(0)))
+
+// argRegs are integer and float registers for arguments of the register based calling convention,
+// architectures not listed pass all arguments on stack, see internal/abi.
+var argRegs = map[string][2]int{
+	"amd64":   {9, 15},
+	"arm64":   {16, 16},
+	"loong64": {16, 16},
+	"ppc64":   {12, 12},
+	"ppc64le": {12, 12},
+	"riscv64": {16, 16},
+	"s390x":   {8, 16},
+}
+
+// funcHead mirrors the leading fields of runtime._func.
+type funcHead struct {
+	entryOff uint32 // all ones for runtime.funcinl of inlined functions
+	nameOff  int32
+	args     int32 // size of argument frame
+}
+
+// frameSize returns the size of argument frame recorded by the runtime of the function at entry, linked
+// modules are registered to the runtime by goloader. ok is false if the function is not found.
+func frameSize(entry uintptr) (n int, ok bool) {
+	f := runtime.FuncForPC(entry)
+	if f == nil || f.Entry() != entry {
+		return 0, false
+	}
+	h := (*funcHead)(unsafe.Pointer(f))
+	if h.entryOff == ^uint32(0) {
+		return 0, false
+	}
+	return int(h.args), true
+}
+
+// frame assigns arguments to registers or stack as the compiler does.
+type frame struct {
+	ints, floats int // registers available
+	stack        int
+}
+
+// add a value of type t, returns true if it is assigned to registers.
+func (f *frame) add(t reflect.Type) bool {
+	if t.Size() > 0 {
+		x := *f
+		if x.assign(t) {
+			*f = x
+			return true
+		}
+	}
+	f.stack = align(f.stack, t.Align()) + int(t.Size())
+	return false
+}
+
+// assign reserves registers for a value of type t, false if registers are not enough or t must be on stack.
+func (f *frame) assign(t reflect.Type) bool {
+	ints, floats := 0, 0
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Pointer, reflect.UnsafePointer, reflect.Chan, reflect.Map, reflect.Func:
+		ints = (int(t.Size()) + ptrSize - 1) / ptrSize
+	case reflect.Float32, reflect.Float64:
+		floats = 1
+	case reflect.Complex64, reflect.Complex128:
+		floats = 2
+	case reflect.String, reflect.Interface:
+		ints = 2
+	case reflect.Slice:
+		ints = 3
+	case reflect.Array:
+		switch t.Len() {
+		case 0:
+			return true
+		case 1:
+			return f.assign(t.Elem())
+		}
+		return false
+	case reflect.Struct:
+		for i := range t.NumField() {
+			if !f.assign(t.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	}
+	if ints > f.ints || floats > f.floats {
+		return false
+	}
+	f.ints -= ints
+	f.floats -= floats
+	return true
+}
+
+// argsSize returns the size of argument frame of function type t: arguments and results on stack, followed by
+// the spill area of arguments in registers.
+func argsSize(t reflect.Type) int {
+	regs := argRegs[runtime.GOARCH]
+	f := frame{ints: regs[0], floats: regs[1]}
+	spill := 0
+	for i := range t.NumIn() {
+		if x := t.In(i); f.add(x) {
+			spill = align(spill, x.Align()) + int(x.Size())
+		}
+	}
+	f = frame{ints: regs[0], floats: regs[1], stack: align(f.stack, ptrSize)}
+	for i := range t.NumOut() {
+		f.add(t.Out(i))
+	}
+	return align(f.stack, ptrSize) + align(spill, ptrSize)
+}
+
+func align(n, a int) int {
+	return (n + a - 1) &^ (a - 1)
+}
@@ -0,0 +1,38 @@
+package pool
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+//go:noinline
+func mixed(a int8, s string, b bool) (x int16, err error) {
+	return int16(a) + int16(len(s)), nil
+}
+
+//go:noinline
+func spilled(a [2]int, b struct{}, c, d, e, f, g, h, i, j, k, l int, m complex128, n []byte) (x [3]byte, y float64, z string) {
+	return
+}
+
+func TestFrameSize(t *testing.T) {
+	for _, f := range []any{mixed, spilled, strings.Repeat, strconv.AppendInt, fmt.Sprintf, TestFrameSize} {
+		v := reflect.ValueOf(f)
+		n, ok := frameSize(v.Pointer())
+		if !ok {
+			t.Fatalf("%T not found", f)
+		}
+		if x := argsSize(v.Type()); x != n {
+			t.Fatalf("%T: expect %d got %d", f, n, x)
+		}
+	}
+	if n, _ := frameSize(reflect.ValueOf(mixed).Pointer()); n == argsSize(reflect.TypeFor[func(int8, string, bool, int) (int16, error)]()) {
+		t.Fatal("mismatched signature should differ")
+	}
+	if _, ok := frameSize(reflect.ValueOf(mixed).Pointer() + 1); ok {
+		t.Fatal("only entry of functions should be found")
+	}
+}
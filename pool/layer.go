@@ -0,0 +1,90 @@
+package pool
+
+import (
+	"io"
+	"path/filepath"
+	"slices"
+
+	. "github.com/ZenLiuCN/dynamic"
+)
+
+// LoadLayer load a linkable of shared dependencies once, later calls only increase its reference count.
+// A layer is unloaded by [Pool.ReleaseLayer] when no module requires it.
+//
+// Modules declare required layers by manifest, see [WriteManifest].
+func (p *Pool) LoadLayer(file string) (err error) {
+	p.Lock()
+	defer p.unlock()
+	_, err = p.acquire([]string{file})
+	return
+}
+
+// ReleaseLayer decrease reference count of a layer loaded by [Pool.LoadLayer].
+func (p *Pool) ReleaseLayer(file string) (err error) {
+	p.Lock()
+	defer p.unlock()
+	if file, err = filepath.Abs(file); err != nil {
+		return
+	}
+	l, ok := p.Layers[file]
+	if !ok {
+		return ErrNotLoad
+	}
+	p.release(l)
+	return
+}
+
+// acquire load layers not loaded and increase reference counts, acquired layers are released on failure.
+func (p *Pool) acquire(files []string) (v []*Module, err error) {
+	defer func() {
+		if err != nil {
+			p.release(v...)
+			v = nil
+		}
+	}()
+	for _, f := range files {
+		if f, err = filepath.Abs(f); err != nil {
+			return
+		}
+		l, ok := p.Layers[f]
+		if !ok {
+			if err = withManifest(f, nil, func(bin io.Reader, layers []string, _ ...string) (err error) {
+				l, err = p.loadRequired(bin, nil, layers)
+				return
+			}); err != nil {
+				return
+			}
+			p.Layers[f] = l
+		}
+		l.refs++
+		v = append(v, l)
+	}
+	return
+}
+
+// release decrease reference counts of layers, layers no longer required nor depended are unloaded.
+func (p *Pool) release(layers ...*Module) {
+	for _, l := range layers {
+		if l.refs--; l.refs > 0 || !slices.Contains(p.Loaded, l) || len(p.dependents(l)) > 0 {
+			continue
+		}
+		p.drop(l)
+		p.emit(EventUnloaded, l, 0, nil)
+		l.Free(false)
+		p.release(l.layers...)
+	}
+}
+
+// loadRequired load a linkable after layers it requires.
+func (p *Pool) loadRequired(bin io.Reader, version []string, layers []string) (m *Module, err error) {
+	var acquired []*Module
+	if acquired, err = p.acquire(layers); err != nil {
+		return
+	}
+	if m, err = p.loadLinkable(bin, version); err != nil {
+		p.release(acquired...)
+		return
+	}
+	m.layers = acquired
+	return
+}
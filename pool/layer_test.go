@@ -0,0 +1,113 @@
+package pool
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ZenLiuCN/dynamic"
+	"github.com/ZenLiuCN/fn"
+)
+
+// serialize an object file into a linkable.
+func serialize(file, pkg, out string) {
+	d := dynamic.NewDynamic(make(dynamic.Symbols))
+	fn.Panic(d.Initialize(file, pkg))
+	f := fn.Panic1(os.Create(out))
+	defer fn.IgnoreClose(f)
+	fn.Panic(d.Serialize(f))
+}
+
+// layered write a module requires a layer into dir.
+func layered(dir string) (module, layer string) {
+	module, layer = filepath.Join(dir, "sample.linkable"), filepath.Join(dir, "layer.linkable")
+	serialize("../testdata/constant.o", "sample", module)
+	serialize("../testdata/func.o", "layer", layer)
+	fn.Panic(dynamic.WriteManifest(module, []string{layer}))
+	return
+}
+
+func TestLayer(t *testing.T) {
+	p := fn.Panic1(NewPool())
+	d := dynamic.Proto(nil)
+	p.RegisterTypes(&d)
+	module, layer := layered(t.TempDir())
+	fn.Panic(p.LoadLinkableFile(module))
+	l := p.Layers[layer]
+	if l == nil || l.refs != 1 || p.Modules[Key{PkgPath: "layer"}] != l {
+		t.Fatalf("layer should be loaded once: %+v", p.Layers)
+	}
+	fn.Panic(p.LoadLayer(layer))
+	if len(p.Loaded) != 2 || l.refs != 2 {
+		t.Fatalf("layer should not be loaded twice: %d refs", l.refs)
+	}
+	fn.Panic(p.ReleaseLayer(layer))
+	if !slices.Contains(p.Loaded, l) || l.refs != 1 {
+		t.Fatalf("layer required by module should be kept: %d refs", l.refs)
+	}
+	fn.Panic(p.Unload("sample"))
+	if len(p.Loaded) != 0 || len(p.Layers) != 0 {
+		t.Fatalf("layer should be unloaded with the last module requires it: %+v", p.Layers)
+	}
+	if err := p.ReleaseLayer(layer); err != ErrNotLoad {
+		t.Fatalf("expect ErrNotLoad, got %v", err)
+	}
+}
+
+func TestReloadLayer(t *testing.T) {
+	p := fn.Panic1(NewPool())
+	d := dynamic.Proto(nil)
+	p.RegisterTypes(&d)
+	module, layer := layered(t.TempDir())
+	fn.Panic(p.LoadLinkableFile(module))
+	old := p.Layers[layer]
+	fn.Panic(p.ReloadLinkableFile(layer))
+	l := p.Layers[layer]
+	if l == nil || l == old || !slices.Contains(p.Loaded, l) || l.refs != 1 {
+		t.Fatalf("reloaded layer should take place of the old: %+v", p.Layers)
+	}
+	if m := p.Modules[Key{PkgPath: "sample"}]; len(m.layers) != 1 || m.layers[0] != l {
+		t.Fatalf("module should require the reloaded layer: %+v", m.layers)
+	}
+	fn.Panic(p.Unload("sample"))
+	if len(p.Loaded) != 0 || len(p.Layers) != 0 {
+		t.Fatalf("reloaded layer should be released: %+v", p.Layers)
+	}
+}
+
+func TestRestoreLayer(t *testing.T) {
+	p := fn.Panic1(NewPool())
+	d := dynamic.Proto(nil)
+	p.RegisterTypes(&d)
+	dir := t.TempDir()
+	module, layer := layered(dir)
+	fn.Panic(p.LoadLinkableFile(module))
+	fn.Panic(p.LoadLayer(layer))
+	b := fn.Panic1(json.Marshal(p.Snapshot()))
+	p.Free()
+	var s Snapshot
+	fn.Panic(json.Unmarshal(b, &s))
+	r := fn.Panic1(Restore(&s, nil, &d))
+	l := r.Layers[layer]
+	if l == nil || l.refs != 2 || r.Modules[Key{PkgPath: "layer"}] != l {
+		t.Fatalf("layer should be restored as a layer: %+v", r.Layers)
+	}
+	if m := r.Modules[Key{PkgPath: "sample"}]; m == nil || len(m.layers) != 1 || m.layers[0] != l {
+		t.Fatal("restored module should require the restored layer")
+	}
+	other := filepath.Join(dir, "other.linkable")
+	serialize("../testdata/constant.o", "other", other)
+	fn.Panic(dynamic.WriteManifest(other, []string{layer}))
+	fn.Panic(r.LoadLinkableFile(other))
+	if len(r.Layers) != 1 || l.refs != 3 {
+		t.Fatalf("restored layer should be shared: %d refs", l.refs)
+	}
+	fn.Panic(r.Unload("sample"))
+	fn.Panic(r.Unload("other"))
+	fn.Panic(r.ReleaseLayer(layer))
+	if len(r.Loaded) != 0 || len(r.Layers) != 0 {
+		t.Fatalf("restored layer should be released: %+v", r.Layers)
+	}
+}
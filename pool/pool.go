@@ -1,213 +1,811 @@
 package pool
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	. "github.com/ZenLiuCN/dynamic"
 	"github.com/ZenLiuCN/fn"
 	"github.com/pkujhd/goloader"
 	"io"
+	"maps"
+	"net/url"
+	"os"
+	"reflect"
 	"slices"
+	"strings"
 	"sync"
+	"time"
 )
 
-type Pool struct {
-	Symbols
-	Modules map[string]Dynamic
-	Loaded  []Dynamic
-	sync.RWMutex
-}
+type (
+	// Key identify a version of package inside a Pool, it's written as 'pkgPath@version'.
+	Key struct {
+		PkgPath string
+		Version string
+	}
+	// Module is a linked Dynamic with its version and packages.
+	Module struct {
+		*Dynamic
+		Version  string
+		Packages []string
+		File     string    // source file, empty for linkable loaded from reader
+		Hash     string    // hex encoded sha256 of source content
+		data     []byte    // serialized linker for relinking, nil for object file
+		deps     []*Module // modules provide resolved symbols
+		layers   []*Module // layers required by manifest
+		refs     int       // count of modules require the layer
+	}
+	// Pool holds modules by package path and version.
+	//
+	// Each package has a current version whose symbols are exposed to later loaded modules,
+	// symbols of other versions are only visible via [Pool.Require] with an explicit version.
+	//
+	// Symbols exported by different packages are registered under a ConflictPolicy, which should be set by
+	// [Pool.SetConflictPolicy] before loading any module.
+	Pool struct {
+		symbols   *SymbolLayer
+		registrar Registrar
+		Modules   map[Key]*Module
+		Current   map[string]string // package path to current version
+		Loaded    []*Module
+		Layers    map[string]*Module // layers by absolute file path
+		sync.RWMutex
+		events  Events
+		pending []Event // events deliver after unlock
+	}
+)
+
+// CurrentVersion is an alias of the current version of a package.
+const CurrentVersion = "current"
 
 var (
 	ErrAlreadyLoad    = errors.New("module already loaded")
 	ErrNotLoad        = errors.New("module not loaded")
 	ErrMissingPackage = errors.New("package not loaded")
 	ErrCorrupted      = errors.New("recording corrupted")
+	ErrNotFunction    = errors.New("not a function type")
 )
 
+// ParseKey parse 'pkgPath@version' into Key, the package path default is main.
+func ParseKey(s string) (k Key) {
+	if i := strings.LastIndexByte(s, '@'); i >= 0 {
+		k.PkgPath, k.Version = s[:i], s[i+1:]
+	} else {
+		k.PkgPath = s
+	}
+	if k.PkgPath == "" {
+		k.PkgPath = "main"
+	}
+	return
+}
+
+func (k Key) String() string {
+	if k.Version == "" {
+		return k.PkgPath
+	}
+	return k.PkgPath + "@" + k.Version
+}
+
+// FileName returns the name of an object file or go archive of the key for [Pool.LoadDir], the ext is '.o' or '.a'.
+func (k Key) FileName(ext string) string {
+	return url.PathEscape(k.String()) + ext
+}
+
+// owns check if symbol belongs to the package, symbols not belongs to any package of the module are
+// treated as belongs to all of them.
+func (m *Module) owns(pkg, sym string) bool {
+	if strings.HasPrefix(sym, pkg+".") {
+		return true
+	}
+	for _, x := range m.Packages {
+		if strings.HasPrefix(sym, x+".") {
+			return false
+		}
+	}
+	return true
+}
+
 func (p *Pool) RegisterSo(path string) error {
-	return goloader.RegSymbolWithSo(p.Symbols, path)
+	return p.symbols.Update(func(own map[string]uintptr) error {
+		return goloader.RegSymbolWithSo(own, path)
+	})
 }
 func (p *Pool) RegisterExecute(path string) error {
-	return goloader.RegSymbolWithPath(p.Symbols, path)
+	return p.symbols.Update(func(own map[string]uintptr) error {
+		return goloader.RegSymbolWithPath(own, path)
+	})
 }
 func (p *Pool) RegisterTypes(t ...any) {
-	goloader.RegTypes(p.Symbols, t...)
+	_ = p.symbols.Update(func(own map[string]uintptr) error {
+		goloader.RegTypes(own, t...)
+		return nil
+	})
 }
 
-// LoadFile load from go archive or go object file
-func (p *Pool) LoadFile(file, pkgPath string) (err error) {
+// RegisterSymbols register symbols, such as types registered by a generated RegisterModuleTypes, see
+// [GenerateModuleTypes].
+func (p *Pool) RegisterSymbols(sym Symbols) {
+	_ = p.symbols.Update(func(own map[string]uintptr) error {
+		maps.Copy(own, sym)
+		return nil
+	})
+}
+
+// SetConflictPolicy set the policy of symbols conflict for later registrations.
+func (p *Pool) SetConflictPolicy(policy ConflictPolicy) {
 	p.Lock()
 	defer p.Unlock()
-	if pkgPath == "" {
-		pkgPath = "main"
-	}
-	if _, ok := p.Modules[pkgPath]; ok {
+	p.registrar.Policy = policy
+}
+
+// Conflicts returns all symbol conflicts seen by registrations of the pool.
+func (p *Pool) Conflicts() []Conflict {
+	p.RLock()
+	defer p.RUnlock()
+	return p.registrar.Conflicts()
+}
+
+// LoadFile load from go archive or go object file, the pkgPath can be suffixed with '@version' to load
+// a version side by side with others.
+func (p *Pool) LoadFile(file, pkgPath string) (err error) {
+	p.Lock()
+	defer p.unlock()
+	k := ParseKey(pkgPath)
+	if _, ok := p.Modules[k]; ok {
 		return ErrAlreadyLoad
 	}
-	d := NewDynamic(p.Symbols)
-	if err = d.Initialize(file, pkgPath); err != nil {
+	m := &Module{Version: k.Version, Packages: []string{k.PkgPath}, File: file}
+	if m.Hash, err = hashFile(file); err != nil {
+		p.emit(EventFailed, m, 0, err)
+		return
+	}
+	if err = p.initialize(m); err != nil {
+		return
+	}
+	return p.link(m)
+}
+
+func hashFile(file string) (string, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return hash(b), nil
+}
+func hash(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+// renew create and initialize a fresh Dynamic from source of the module.
+func (m *Module) renew(sym *SymbolLayer) (err error) {
+	m.Dynamic = NewDynamic(sym)
+	if m.data == nil {
+		return m.Initialize(m.File, m.Packages[0])
+	}
+	if err = m.InitializeSerialized(bytes.NewReader(m.data)); err != nil {
+		return
+	}
+	if m.Packages == nil {
+		for _, pkg := range m.GetLinker().Packages {
+			m.Packages = append(m.Packages, pkg.PkgPath)
+		}
+		slices.Sort(m.Packages)
+	}
+	return
+}
+
+// initialize the module with events.
+func (p *Pool) initialize(m *Module) (err error) {
+	t := time.Now()
+	if err = m.renew(p.symbols); err != nil {
+		p.emit(EventFailed, m, time.Since(t), err)
+		return
+	}
+	p.emit(EventInitialized, m, time.Since(t), nil)
+	return
+}
+
+// link resolve dependencies and link an initialized module then records it.
+func (p *Pool) link(m *Module) (err error) {
+	m.deps = p.providers(m)
+	t := time.Now()
+	if err = m.Link(); err != nil {
+		p.emit(EventFailed, m, time.Since(t), err)
+		m.Free(false)
+		return
+	}
+	if err = p.check(m); err != nil {
+		p.emit(EventFailed, m, time.Since(t), err)
+		m.Free(false)
 		return
 	}
-	p.Modules[pkgPath] = d
-	p.Loaded = append(p.Loaded, d)
-	if err = d.Link(); err != nil {
+	p.emit(EventLinked, m, time.Since(t), nil)
+	p.add(m)
+	return
+}
+
+// emit queues an event for each package of the module.
+func (p *Pool) emit(kind EventKind, m *Module, d time.Duration, err error) {
+	e := Event{Kind: kind, Version: m.Version, Source: m.File, Hash: m.Hash, Duration: d, Err: err}
+	if len(m.Packages) == 0 {
+		p.pending = append(p.pending, e)
 		return
 	}
-	p.register(d)
+	for _, pkg := range m.Packages {
+		e.PkgPath = pkg
+		p.pending = append(p.pending, e)
+	}
+}
+
+// unlock release the write lock then deliver pending events.
+func (p *Pool) unlock() {
+	e := p.pending
+	p.pending = nil
+	p.Unlock()
+	p.events.Emit(e...)
+}
+
+// Subscribe register a listener of lifecycle events of the pool.
+func (p *Pool) Subscribe(l Listener) (cancel func()) {
+	return p.events.Subscribe(l)
+}
+
+// Events subscribe lifecycle events of the pool into a buffered channel, see [Events.Channel].
+func (p *Pool) Events(size int) (ch <-chan Event, cancel func()) {
+	return p.events.Channel(size)
+}
+
+// providers find loaded modules which provide the external symbols of the module.
+func (p *Pool) providers(m *Module) (v []*Module) {
+	for _, name := range goloader.UnresolvedSymbols(m.GetLinker(), nil) {
+		u, ok := p.symbols.Lookup(name)
+		if !ok {
+			continue
+		}
+		for _, x := range p.Loaded {
+			if a, ok := x.GetModule().Syms[name]; ok && a == u && !slices.Contains(v, x) {
+				v = append(v, x)
+				break
+			}
+		}
+	}
 	return
 }
-func (p *Pool) register(d Dynamic) {
-	for s, u := range d.GetModule().Syms {
-		if _, ok := p.Symbols[s]; ok {
+
+// dependents find modules depend on any of the modules directly or indirectly, in load order.
+func (p *Pool) dependents(modules ...*Module) (v []*Module) {
+	set := slices.Clone(modules)
+	for _, x := range p.Loaded {
+		if slices.Contains(set, x) {
 			continue
-		} else {
-			p.Symbols[s] = u
+		}
+		if slices.ContainsFunc(x.deps, func(d *Module) bool {
+			return slices.Contains(set, d)
+		}) {
+			set = append(set, x)
+			v = append(v, x)
 		}
 	}
+	return
 }
-func (p *Pool) unregister(d Dynamic) {
-	for s, u := range d.GetModule().Syms {
-		if x, ok := p.Symbols[s]; ok && x == u {
-			delete(p.Symbols, s)
+
+// currents returns packages which the module is current version of.
+func (p *Pool) currents(m *Module) (v []string) {
+	for _, pkg := range m.Packages {
+		if c, ok := p.Current[pkg]; ok && c == m.Version {
+			v = append(v, pkg)
 		}
 	}
+	return
 }
 
-// LoadLinkable load from serialized link
-func (p *Pool) LoadLinkable(bin io.Reader) (err error) {
-	p.Lock()
-	defer p.Unlock()
-	d := NewDynamic(p.Symbols)
-	if err = d.InitializeSerialized(bin); err != nil {
+// state is a copy of pool records.
+type state struct {
+	modules map[Key]*Module
+	current map[string]string
+	loaded  []*Module
+	layers  map[string]*Module
+}
+
+func (p *Pool) save() state {
+	return state{maps.Clone(p.Modules), maps.Clone(p.Current), slices.Clone(p.Loaded), maps.Clone(p.Layers)}
+}
+
+// restore records and symbols of a saved state, modules linked after save must be freed by caller.
+func (p *Pool) restore(s state) {
+	for _, m := range p.Loaded {
+		p.unregister(m)
+	}
+	p.Modules, p.Current, p.Loaded, p.Layers = s.modules, s.current, s.loaded, s.layers
+	for _, m := range p.Loaded {
+		p.register(m)
+	}
+}
+
+// register exposes symbols of packages which the module is current for.
+func (p *Pool) register(m *Module) {
+	for _, pkg := range m.Packages {
+		p.registerPackage(m, pkg)
+	}
+}
+func (p *Pool) registerPackage(m *Module, pkg string) {
+	if v, ok := p.Current[pkg]; !ok || v != m.Version {
 		return
 	}
-	l := d.GetLinker()
-	for _, pkg := range l.Packages {
-		if _, ok := p.Modules[pkg.PkgPath]; ok {
-			return ErrAlreadyLoad
+	// the layer of a pool is always mutable
+	v, _ := p.registrar.Register(p.symbols, Key{pkg, m.Version}.String(), m.GetModule().Syms, func(s string) bool {
+		return m.owns(pkg, s)
+	})
+	for _, c := range v {
+		p.pending = append(p.pending, Event{Kind: EventConflict, PkgPath: pkg, Version: m.Version, Source: m.File, Hash: m.Hash, Symbol: c.Symbol})
+	}
+}
+func (p *Pool) unregister(m *Module) {
+	for _, pkg := range m.Packages {
+		p.unregisterPackage(m, pkg)
+	}
+}
+func (p *Pool) unregisterPackage(m *Module, pkg string) {
+	_ = p.registrar.Unregister(p.symbols, Key{pkg, m.Version}.String(), m.GetModule().Syms, func(s string) bool {
+		return m.owns(pkg, s)
+	})
+}
+
+// check conflicts of packages the module will be current for, returns error only under ConflictError.
+func (p *Pool) check(m *Module) error {
+	var errs []error
+	for _, pkg := range m.Packages {
+		if _, ok := p.Current[pkg]; ok {
+			continue
+		}
+		errs = append(errs, p.registrar.CheckError(p.symbols, Key{pkg, m.Version}.String(), m.GetModule().Syms, func(s string) bool {
+			return m.owns(pkg, s)
+		}))
+	}
+	return errors.Join(errs...)
+}
+
+// add records a linked Module, it becomes the current version of packages without one.
+func (p *Pool) add(m *Module) {
+	for _, pkg := range m.Packages {
+		p.Modules[Key{pkg, m.Version}] = m
+		if _, ok := p.Current[pkg]; !ok {
+			p.Current[pkg] = m.Version
+		}
+	}
+	p.Loaded = append(p.Loaded, m)
+	p.register(m)
+}
+
+// drop removes records of a Module, the latest loaded version left becomes current of its packages.
+func (p *Pool) drop(m *Module) {
+	p.unregister(m)
+	maps.DeleteFunc(p.Modules, func(_ Key, v *Module) bool {
+		return v == m
+	})
+	p.Loaded = slices.DeleteFunc(p.Loaded, func(v *Module) bool {
+		return v == m
+	})
+	maps.DeleteFunc(p.Layers, func(_ string, v *Module) bool {
+		return v == m
+	})
+	for _, pkg := range m.Packages {
+		if v, ok := p.Current[pkg]; !ok || v != m.Version {
+			continue
+		}
+		delete(p.Current, pkg)
+		for i := len(p.Loaded) - 1; i >= 0; i-- {
+			if x := p.Loaded[i]; slices.Contains(x.Packages, pkg) {
+				p.Current[pkg] = x.Version
+				p.registerPackage(x, pkg)
+				break
+			}
 		}
-		p.Modules[pkg.PkgPath] = d
 	}
-	p.Loaded = append(p.Loaded, d)
-	if err = d.Link(); err != nil {
+}
+
+// replace links m as the new provider of its packages in place of old modules.
+//
+// Modules depend on old are unloaded in reverse order and relinked against m, the relinked modules take
+// place of the unloaded ones as layers. Linkables are relinked from the loaded content, object files are
+// read again and must have the same content hash.
+// Nothing is released until all of them are linked, on any failure the pool is restored and
+// the new linked modules are freed.
+func (p *Pool) replace(m *Module, old ...*Module) (err error) {
+	for _, o := range old {
+		if !slices.Contains(p.Loaded, o) {
+			m.Free(false)
+			return ErrCorrupted
+		}
+	}
+	affected := p.dependents(old...)
+	var current []string
+	for _, o := range old {
+		current = append(current, p.currents(o)...)
+	}
+	currents := make(map[*Module][]string, len(affected))
+	for _, a := range affected {
+		currents[a] = p.currents(a)
+	}
+	files := make(map[*Module]string, len(p.Layers))
+	for f, l := range p.Layers {
+		files[l] = f
+	}
+	renewed := make(map[*Module]*Module, len(affected)+len(old))
+	s := p.save()
+	for i := len(affected) - 1; i >= 0; i-- {
+		p.drop(affected[i])
+	}
+	for _, o := range old {
+		p.drop(o)
+	}
+	var linked []*Module
+	defer func() {
+		if err != nil {
+			p.restore(s)
+			for _, x := range linked {
+				p.emit(EventUnloaded, x, 0, nil)
+				x.Free(false)
+			}
+			return
+		}
+		for x, n := range renewed {
+			if f, ok := files[x]; ok {
+				p.Layers[f] = n
+				n.refs = x.refs
+			}
+		}
+		for _, x := range p.Loaded {
+			for i, l := range x.layers {
+				if n, ok := renewed[l]; ok {
+					x.layers[i] = n
+				}
+			}
+		}
+		for _, x := range slices.Concat(affected, old) {
+			x.Free(false)
+		}
+		for _, o := range old {
+			p.release(o.layers...)
+		}
+		for _, x := range linked {
+			p.emit(EventReloaded, x, 0, nil)
+		}
+	}()
+	if err = p.link(m); err != nil {
 		return
 	}
-	p.register(d)
+	linked = append(linked, m)
+	for _, o := range old {
+		renewed[o] = m
+	}
+	for _, pkg := range current {
+		if slices.Contains(m.Packages, pkg) {
+			p.promote(m, pkg)
+		}
+	}
+	for _, a := range affected {
+		n := &Module{Version: a.Version, Packages: a.Packages, File: a.File, Hash: a.Hash, data: a.data, layers: slices.Clone(a.layers)}
+		if err = p.unchanged(n); err != nil {
+			p.emit(EventFailed, n, 0, err)
+			return
+		}
+		if err = p.initialize(n); err != nil {
+			return
+		}
+		if err = p.link(n); err != nil {
+			return
+		}
+		linked = append(linked, n)
+		renewed[a] = n
+		for _, pkg := range currents[a] {
+			p.promote(n, pkg)
+		}
+	}
 	return
 }
 
-// ReloadFile from go archive or go object file
-func (p *Pool) ReloadFile(file, pkgPath string) (err error) {
-	p.Lock()
-	defer p.Unlock()
-	if pkgPath == "" {
-		pkgPath = "main"
+// unchanged check the source file of an object module still has the content loaded, object files can only be read
+// from disk to relink.
+func (p *Pool) unchanged(m *Module) (err error) {
+	if m.data != nil {
+		return
 	}
-	if m, ok := p.Modules[pkgPath]; !ok {
+	var h string
+	if h, err = hashFile(m.File); err == nil && h != m.Hash {
+		err = fmt.Errorf("%w: %s changed since loaded", ErrHashMismatch, m.File)
+	}
+	return
+}
+
+// Unload a module by 'pkgPath[@version]' with all modules depend on it, in reverse load order.
+func (p *Pool) Unload(pkgPath string) error {
+	p.Lock()
+	defer p.unlock()
+	m, _, ok := p.resolve(pkgPath)
+	if !ok {
 		return ErrNotLoad
-	} else {
-		i := slices.Index(p.Loaded, m)
-		if i < 0 {
-			return ErrCorrupted
+	}
+	x := append([]*Module{m}, p.dependents(m)...)
+	for i := len(x) - 1; i >= 0; i-- {
+		p.drop(x[i])
+		p.emit(EventUnloaded, x[i], 0, nil)
+		x[i].Free(false)
+	}
+	for _, m := range x {
+		p.release(m.layers...)
+	}
+	return nil
+}
+
+// promote make the module the current version of package.
+func (p *Pool) promote(m *Module, pkg string) {
+	if v, ok := p.Current[pkg]; ok {
+		if v == m.Version {
+			return
 		}
-		x := p.Loaded[i:]
-		for i := len(x); i >= 0; i-- {
-			dyn := x[i]
-			delete(p.Modules, fn.MapKeyOf(p.Modules, dyn))
-			p.unregister(dyn)
-			dyn.Free(false)
+		if o, ok := p.Modules[Key{pkg, v}]; ok {
+			p.unregisterPackage(o, pkg)
 		}
-		p.Loaded = p.Loaded[:i]
 	}
-	d := NewDynamic(p.Symbols)
-	if err = d.Initialize(file, pkgPath); err != nil {
-		return
+	p.Current[pkg] = m.Version
+	p.registerPackage(m, pkg)
+}
+
+// Promote atomically repoint the current version of package to a loaded version.
+func (p *Pool) Promote(pkgPath, version string) error {
+	p.Lock()
+	defer p.unlock()
+	k := ParseKey(pkgPath)
+	k.Version = version
+	m, ok := p.Modules[k]
+	if !ok {
+		return ErrNotLoad
 	}
-	p.Modules[pkgPath] = d
-	p.Loaded = append(p.Loaded, d)
-	if err = d.Link(); err != nil {
+	p.promote(m, k.PkgPath)
+	return nil
+}
+
+// LoadLinkable load from serialized link, with an optional version.
+func (p *Pool) LoadLinkable(bin io.Reader, version ...string) (err error) {
+	p.Lock()
+	defer p.unlock()
+	_, err = p.loadLinkable(bin, version)
+	return
+}
+
+func (p *Pool) loadLinkable(bin io.Reader, version []string) (m *Module, err error) {
+	if m, err = p.newModule(bin, version); err != nil {
 		return
 	}
-	p.register(d)
+	for _, pkg := range m.Packages {
+		if _, ok := p.Modules[Key{pkg, m.Version}]; ok {
+			m.Free(false)
+			return nil, ErrAlreadyLoad
+		}
+	}
+	err = p.link(m)
 	return
 }
 
-// ReloadLinkable from serialized link
-func (p *Pool) ReloadLinkable(bin io.Reader) (err error) {
+// ReloadFile from go archive or go object file, the pkgPath is resolved as [Pool.Require] does,
+// without a version or with [CurrentVersion] the current version is reloaded.
+//
+// The new module is linked before the old one is released, on any failure the pool keeps
+// running the old module.
+func (p *Pool) ReloadFile(file, pkgPath string) (err error) {
 	p.Lock()
-	defer p.Unlock()
-	d := NewDynamic(p.Symbols)
-	if err = d.InitializeSerialized(bin); err != nil {
+	defer p.unlock()
+	o, k, ok := p.resolve(pkgPath)
+	if !ok {
+		return ErrNotLoad
+	}
+	m := &Module{Version: k.Version, Packages: []string{k.PkgPath}, File: file}
+	if m.Hash, err = hashFile(file); err != nil {
+		p.emit(EventFailed, m, 0, err)
 		return
 	}
-	l := d.GetLinker()
-	var dyn []Dynamic
-	for _, pkg := range l.Packages {
-		if dx, ok := p.Modules[pkg.PkgPath]; ok {
-			dyn = append(dyn, dx)
+	if err = p.initialize(m); err != nil {
+		return
+	}
+	return p.replace(m, o)
+}
+
+// ReloadLinkable from serialized link, with an optional version.
+//
+// The new module is linked before the old ones are released, on any failure the pool keeps
+// running the old modules.
+func (p *Pool) ReloadLinkable(bin io.Reader, version ...string) (err error) {
+	p.Lock()
+	defer p.unlock()
+	return p.reloadLinkable(bin, version, nil)
+}
+
+// reloadLinkable replace modules with the new one requires layers, the layers are released on failure.
+func (p *Pool) reloadLinkable(bin io.Reader, version []string, layers []*Module) (err error) {
+	defer func() {
+		if err != nil {
+			p.release(layers...)
 		}
+	}()
+	var m *Module
+	if m, err = p.newModule(bin, version); err != nil {
+		return
 	}
-	if len(dyn) > 0 {
-		var i = 0xFFFFFFFF
-		for _, dy := range dyn {
-			x := slices.Index(p.Loaded, dy)
-			if x < 0 {
-				return ErrCorrupted
-			}
-			if x < i {
-				i = x
-			}
+	m.layers = layers
+	var old []*Module
+	for _, pkg := range m.Packages {
+		if o, ok := p.Modules[Key{pkg, m.Version}]; ok && !slices.Contains(old, o) {
+			old = append(old, o)
 		}
-		x := p.Loaded[i:]
-		for i := len(x); i >= 0; i-- {
-			dyn := x[i]
-			delete(p.Modules, fn.MapKeyOf(p.Modules, dyn))
-			p.unregister(dyn)
-			dyn.Free(false)
+	}
+	return p.replace(m, old...)
+}
+
+// LoadLinkableFile load from serialized link file, with an optional version.
+//
+// Layers declared by the manifest of the file are loaded before, see [Pool.LoadLayer].
+func (p *Pool) LoadLinkableFile(file string, version ...string) (err error) {
+	return withManifest(file, version, func(bin io.Reader, layers []string, version ...string) (err error) {
+		p.Lock()
+		defer p.unlock()
+		_, err = p.loadRequired(bin, version, layers)
+		return
+	})
+}
+
+// ReloadLinkableFile reload from serialized link file, with an optional version.
+//
+// Layers declared by the manifest of the file are loaded before, and layers required by the old modules are
+// released after reloaded.
+func (p *Pool) ReloadLinkableFile(file string, version ...string) (err error) {
+	return withManifest(file, version, func(bin io.Reader, layers []string, version ...string) (err error) {
+		p.Lock()
+		defer p.unlock()
+		var acquired []*Module
+		if acquired, err = p.acquire(layers); err != nil {
+			return
 		}
-		p.Loaded = p.Loaded[:i]
+		return p.reloadLinkable(bin, version, acquired)
+	})
+}
+
+func withManifest(file string, version []string, act func(io.Reader, []string, ...string) error) (err error) {
+	var m *Manifest
+	if m, err = ReadManifest(file); err != nil {
+		return
 	}
-	for _, pkg := range l.Packages {
-		p.Modules[pkg.PkgPath] = d
+	var layers []string
+	if m != nil {
+		layers = m.Requires
 	}
-	p.Loaded = append(p.Loaded, d)
-	if err = d.Link(); err != nil {
+	return withFile(file, version, func(bin io.Reader, version ...string) error {
+		return act(bin, layers, version...)
+	})
+}
+
+func withFile(file string, version []string, act func(io.Reader, ...string) error) (err error) {
+	var f *os.File
+	if f, err = os.Open(file); err != nil {
 		return
 	}
-	p.register(d)
+	defer fn.IgnoreClose(f)
+	return act(&source{Reader: f, file: file}, version...)
+}
+
+// source is a reader carries its file path.
+type source struct {
+	io.Reader
+	file string
+}
+
+// newModule read and initialize a module from serialized linker.
+func (p *Pool) newModule(bin io.Reader, version []string) (m *Module, err error) {
+	m = new(Module)
+	if x, ok := bin.(*source); ok {
+		m.File = x.file
+	}
+	if len(version) > 0 {
+		m.Version = version[0]
+	}
+	if m.data, err = io.ReadAll(bin); err != nil {
+		p.emit(EventFailed, m, 0, err)
+		return
+	}
+	m.Hash = hash(m.data)
+	err = p.initialize(m)
+	return
+}
+
+// resolve find module by 'pkgPath[@version]', without a version or with [CurrentVersion] the
+// current version is used.
+func (p *Pool) resolve(pkgPath string) (m *Module, k Key, ok bool) {
+	k = ParseKey(pkgPath)
+	if k.Version == CurrentVersion || strings.IndexByte(pkgPath, '@') < 0 {
+		if k.Version, ok = p.Current[k.PkgPath]; !ok {
+			return
+		}
+	}
+	m, ok = p.Modules[k]
 	return
 }
 
-// Require fetch symbol from package
+// Require fetch symbol from package, the pkgPath can be suffixed with '@version' to target a
+// specific version, otherwise the current version is used.
+//
+// It panics with ErrMissingPackage or ErrMissingSymbol, see [Pool.Lookup] for a non-panicking version.
 func (p *Pool) Require(pkgPath, symbolName string) Sym {
 	p.RLock()
 	defer p.RUnlock()
-	if pkgPath == "" {
-		pkgPath = "main"
-	}
-	if m, ok := p.Modules[pkgPath]; ok {
-		return m.MustFetch(pkgPath + "." + symbolName)
+	if m, k, ok := p.resolve(pkgPath); ok {
+		if s, ok := m.FetchIn(k.PkgPath, symbolName); ok {
+			return s
+		}
+		panic(ErrMissingSymbol)
 	}
 	panic(ErrMissingPackage)
 }
 
+// Lookup fetch symbol from package as [Pool.Require] does, the symbol name is resolved by [Qualify].
+func (p *Pool) Lookup(pkgPath, symbolName string) (s Sym, err error) {
+	p.RLock()
+	defer p.RUnlock()
+	m, k, ok := p.resolve(pkgPath)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrMissingPackage, pkgPath)
+	}
+	if s, ok = m.FetchIn(k.PkgPath, symbolName); !ok {
+		return 0, fmt.Errorf("%w: %s of %s", ErrMissingSymbol, symbolName, k)
+	}
+	return
+}
+
+// RequireAs fetch a function symbol from package and convert to T by [As], T must be a function type.
+// The argument frame of the function recorded by the runtime must fit T, else returns [ErrSignature].
+// As go object files carry no types of functions, types of the same layout, such as int and uint, are not told apart.
+func RequireAs[T any](p *Pool, pkgPath, symbolName string) (t T, err error) {
+	x := reflect.TypeFor[T]()
+	if x.Kind() != reflect.Func {
+		err = fmt.Errorf("%w: %s", ErrNotFunction, x)
+		return
+	}
+	s := new(Sym)
+	if *s, err = p.Lookup(pkgPath, symbolName); err != nil {
+		return
+	}
+	if n, ok := frameSize(uintptr(*s)); ok && n != argsSize(x) {
+		err = fmt.Errorf("%w: %s of %s is not %s", ErrSignature, symbolName, pkgPath, x)
+		return
+	}
+	return As[T](s), nil
+}
+
 // Free clean all modules
 func (p *Pool) Free() {
 	p.Lock()
-	defer p.Unlock()
-	for _, dynamic := range p.Loaded {
-		p.unregister(dynamic)
-		dynamic.Free(true)
+	defer p.unlock()
+	for _, m := range p.Loaded {
+		p.unregister(m)
+		p.emit(EventUnloaded, m, 0, nil)
+		m.Free(true)
 	}
 	p.Loaded = nil
+	fn.MapClear(p.Layers)
 	fn.MapClear(p.Modules)
+	fn.MapClear(p.Current)
 
 }
 
 // NewPool create new pool
 func NewPool() (p *Pool, err error) {
 	p = new(Pool)
-	p.Modules = make(map[string]Dynamic)
-	p.Symbols, err = NewSymbols()
+	p.Modules = make(map[Key]*Module)
+	p.Current = make(map[string]string)
+	p.Layers = make(map[string]*Module)
+	p.symbols, err = NewSymbolLayer()
 	return
 }
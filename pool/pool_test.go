@@ -4,6 +4,13 @@ import (
 	"github.com/ZenLiuCN/dynamic"
 	"github.com/ZenLiuCN/fn"
 
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
 )
 
@@ -18,3 +25,392 @@ func TestNewPool(t *testing.T) {
 	s1 := p.Require("sample", "NewFactory")
 	t.Logf("%#+v", s1)
 }
+
+func TestRegisterSymbols(t *testing.T) {
+	p := fn.Panic1(NewPool())
+	p.RegisterSymbols(dynamic.Symbols{"type:*sample.T": 1})
+	if u, ok := p.symbols.Lookup("type:*sample.T"); !ok || u != 1 {
+		t.Fatal("symbols should be registered")
+	}
+}
+
+func TestReloadRollback(t *testing.T) {
+	p := fn.Panic1(NewPool())
+	d := dynamic.Proto(nil)
+	p.RegisterTypes(&d)
+	fn.Panic(p.LoadFile("../testdata/constant.a", "sample"))
+	if err := p.ReloadFile("../testdata/not_exists.a", "sample"); err == nil {
+		t.Fatal("reload should fail")
+	}
+	if len(p.Loaded) != 1 || p.Modules[Key{PkgPath: "sample"}] == nil {
+		t.Fatalf("pool state changed after failed reload: %+v", p.Modules)
+	}
+	s0 := p.Require("sample", "Run")
+	t.Log(dynamic.As[func() string](&s0)())
+	fn.Panic(p.ReloadFile("../testdata/constant.a", "sample"))
+	s1 := p.Require("sample", "Run")
+	t.Log(dynamic.As[func() string](&s1)())
+}
+
+func TestReloadLinkFailure(t *testing.T) {
+	p := fn.Panic1(NewPool())
+	d := dynamic.Proto(nil)
+	p.RegisterTypes(&d)
+	fn.Panic(p.LoadFile("../testdata/func.o", "sample"))
+	m := p.Modules[Key{PkgPath: "sample"}]
+	bad := compile(t.TempDir(), "bad", "package sample\n\nimport _ \"unsafe\"\n\n//go:linkname missing nothere.Missing\nfunc missing() string\n\nfunc Run() string { return missing() }\n")
+	if err := p.ReloadFile(bad, "sample"); err == nil {
+		t.Fatal("reload should fail to link")
+	}
+	if len(p.Loaded) != 1 || p.Modules[Key{PkgPath: "sample"}] != m {
+		t.Fatalf("old module should stay loaded: %+v", p.Modules)
+	}
+	f, err := RequireAs[func() string](p, "sample", "Run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(f())
+}
+
+func TestVersions(t *testing.T) {
+	p := fn.Panic1(NewPool())
+	d := dynamic.Proto(nil)
+	p.RegisterTypes(&d)
+	fn.Panic(p.LoadFile("../testdata/constant.a", "sample@v1"))
+	fn.Panic(p.LoadFile("../testdata/func.o", "sample@v2"))
+	if v := p.Current["sample"]; v != "v1" {
+		t.Fatalf("current version should be v1, got %s", v)
+	}
+	s1 := p.Require("sample@v1", "Run")
+	s2 := p.Require("sample@v2", "Run")
+	if s1 == s2 {
+		t.Fatal("versions should not share symbols")
+	}
+	if s := p.Require("sample", "Run"); s != s1 {
+		t.Fatal("current should be v1")
+	}
+	fn.Panic(p.Promote("sample", "v2"))
+	if s := p.Require("sample@current", "Run"); s != s2 {
+		t.Fatal("current should be v2")
+	}
+	t.Log(dynamic.As[func() string](&s2)())
+}
+
+func TestReloadCurrent(t *testing.T) {
+	p := fn.Panic1(NewPool())
+	d := dynamic.Proto(nil)
+	p.RegisterTypes(&d)
+	fn.Panic(p.LoadFile("../testdata/constant.a", "sample@v1"))
+	fn.Panic(p.ReloadFile("../testdata/func.o", "sample"))
+	if len(p.Loaded) != 1 || p.Modules[Key{"sample", "v1"}].File != "../testdata/func.o" {
+		t.Fatalf("current version should be reloaded: %+v", p.Modules)
+	}
+	fn.Panic(p.ReloadFile("../testdata/constant.a", "sample@current"))
+	if p.Current["sample"] != "v1" {
+		t.Fatalf("current version changed: %s", p.Current["sample"])
+	}
+	if err := p.ReloadFile("../testdata/func.o", "other"); err != ErrNotLoad {
+		t.Fatalf("expect ErrNotLoad, got %v", err)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	for s, k := range map[string]Key{
+		"":                    {"main", ""},
+		"sample":              {"sample", ""},
+		"sample@v1":           {"sample", "v1"},
+		"github.com/a/b@v1.0": {"github.com/a/b", "v1.0"},
+	} {
+		if x := ParseKey(s); x != k {
+			t.Errorf("ParseKey(%q) = %v, want %v", s, x, k)
+		}
+	}
+}
+
+// compile write a go source into dir and compile it into an object file.
+func compile(dir, name, src string) string {
+	fn.Panic(os.WriteFile(filepath.Join(dir, name+".go"), []byte(src), 0644))
+	r := fn.Panic1((&dynamic.Builder{Dir: dir}).Compile(context.Background(), []string{name + ".go"}))
+	file := filepath.Join(dir, name+".o")
+	fn.Panic(r.Write(file))
+	return file
+}
+
+const (
+	depSource  = "package dep\n\nfunc Hello() string { return \"dep\" }\n"
+	userSource = "package user\n\nimport _ \"unsafe\"\n\n//go:linkname hello dep.Hello\nfunc hello() string\n\nfunc Run() string { return \"user \" + hello() }\n"
+)
+
+// dependent load module user depends on module dep.
+func dependent(dir string) (p *Pool, dep, user string) {
+	p = fn.Panic1(NewPool())
+	dep, user = compile(dir, "dep", depSource), compile(dir, "user", userSource)
+	fn.Panic(p.LoadFile(dep, "dep"))
+	fn.Panic(p.LoadFile(user, "user"))
+	return
+}
+
+func TestDependents(t *testing.T) {
+	p, dep, _ := dependent(t.TempDir())
+	d, u := p.Modules[Key{PkgPath: "dep"}], p.Modules[Key{PkgPath: "user"}]
+	if v := p.dependents(d); len(v) != 1 || v[0] != u {
+		t.Fatalf("dependents of dep: %v", v)
+	}
+	if v := p.dependents(u); len(v) != 0 {
+		t.Fatalf("dependents of user: %v", v)
+	}
+	fn.Panic(p.ReloadFile(dep, "dep"))
+	if x := p.Modules[Key{PkgPath: "user"}]; x == u || len(x.deps) != 1 || x.deps[0] != p.Modules[Key{PkgPath: "dep"}] {
+		t.Fatal("user should be relinked against the new dep")
+	}
+	if f, err := RequireAs[func() string](p, "user", "Run"); err != nil || f() != "user dep" {
+		t.Fatalf("relinked user: %v", err)
+	}
+}
+
+func TestReloadDependentChanged(t *testing.T) {
+	dir := t.TempDir()
+	p, dep, user := dependent(dir)
+	d, u := p.Modules[Key{PkgPath: "dep"}], p.Modules[Key{PkgPath: "user"}]
+	b := fn.Panic1(os.ReadFile(user))
+	fn.Panic(os.WriteFile(user, append(b, 0), 0644))
+	if err := p.ReloadFile(dep, "dep"); !errors.Is(err, ErrHashMismatch) {
+		t.Fatalf("expect ErrHashMismatch, got %v", err)
+	}
+	if p.Modules[Key{PkgPath: "dep"}] != d || p.Modules[Key{PkgPath: "user"}] != u || len(p.Loaded) != 2 {
+		t.Fatalf("pool state changed after failed reload: %+v", p.Modules)
+	}
+	if f, err := RequireAs[func() string](p, "user", "Run"); err != nil || f() != "user dep" {
+		t.Fatalf("old user should keep running: %v", err)
+	}
+}
+
+func TestUnload(t *testing.T) {
+	p := fn.Panic1(NewPool())
+	d := dynamic.Proto(nil)
+	p.RegisterTypes(&d)
+	fn.Panic(p.LoadFile("../testdata/constant.a", "sample"))
+	fn.Panic(p.Unload("sample"))
+	if len(p.Loaded) != 0 || len(p.Modules) != 0 {
+		t.Fatalf("module not unloaded: %+v", p.Modules)
+	}
+	if err := p.Unload("sample"); err != ErrNotLoad {
+		t.Fatalf("unload twice should fail with ErrNotLoad, got %v", err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	p := fn.Panic1(NewPool())
+	d := dynamic.Proto(nil)
+	p.RegisterTypes(&d)
+	fn.Panic(p.LoadFile("../testdata/constant.a", "sample@v1"))
+	fn.Panic(p.LoadFile("../testdata/func.o", "sample@v2"))
+	fn.Panic(p.Promote("sample", "v2"))
+	s := p.Snapshot()
+	b := fn.Panic1(json.Marshal(s))
+	t.Log(string(b))
+	p.Free()
+	var x Snapshot
+	fn.Panic(json.Unmarshal(b, &x))
+	r := fn.Panic1(Restore(&x, nil, &d))
+	if len(r.Loaded) != 2 || r.Current["sample"] != "v2" {
+		t.Fatalf("restored pool mismatch: %+v", r.Current)
+	}
+	s0 := r.Require("sample", "Run")
+	t.Log(dynamic.As[func() string](&s0)())
+}
+
+func TestRestoreInvalid(t *testing.T) {
+	for _, s := range []Snapshot{
+		{Modules: []ModuleState{{File: "../testdata/func.o", Hash: "x"}}},
+		{Modules: []ModuleState{{Packages: []string{"sample"}, Hash: "x"}}},
+		{Modules: []ModuleState{{File: "../testdata/func.o", Packages: []string{"sample"}, Hash: "x", Requires: []string{"layer.linkable"}}}},
+	} {
+		if _, err := Restore(&s, nil); !errors.Is(err, ErrInvalidSnapshot) {
+			t.Fatalf("expect ErrInvalidSnapshot, got %v", err)
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	p := fn.Panic1(NewPool())
+	d := dynamic.Proto(nil)
+	p.RegisterTypes(&d)
+	var kinds []dynamic.EventKind
+	cancel := p.Subscribe(func(e dynamic.Event) {
+		t.Logf("%s %s@%s %s %s", e.Kind, e.PkgPath, e.Version, e.Duration, e.Hash)
+		kinds = append(kinds, e.Kind)
+	})
+	defer cancel()
+	fn.Panic(p.LoadFile("../testdata/constant.a", "sample"))
+	fn.Panic(p.ReloadFile("../testdata/constant.a", "sample"))
+	fn.Panic(p.Unload("sample"))
+	want := []dynamic.EventKind{
+		dynamic.EventInitialized, dynamic.EventLinked,
+		dynamic.EventInitialized, dynamic.EventLinked, dynamic.EventReloaded,
+		dynamic.EventUnloaded,
+	}
+	if !slices.Equal(kinds, want) {
+		t.Fatalf("events %v, want %v", kinds, want)
+	}
+}
+
+func TestEventsFailed(t *testing.T) {
+	p := fn.Panic1(NewPool())
+	ch, cancel := p.Events(4)
+	defer cancel()
+	if err := p.LoadFile("../testdata/not_exists.a", "sample"); err == nil {
+		t.Fatal("load should fail")
+	}
+	select {
+	case e := <-ch:
+		if e.Kind != dynamic.EventFailed || e.PkgPath != "sample" || e.Err == nil {
+			t.Fatalf("unexpected event %+v", e)
+		}
+	default:
+		t.Fatal("missing failed event")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	p := fn.Panic1(NewPool())
+	d := dynamic.Proto(nil)
+	p.RegisterTypes(&d)
+	fn.Panic(p.LoadFile("../testdata/constant.a", "sample"))
+	if _, err := p.Lookup("other", "Run"); !errors.Is(err, ErrMissingPackage) {
+		t.Fatalf("expect ErrMissingPackage, got %v", err)
+	}
+	if _, err := p.Lookup("sample", "NotExists"); !errors.Is(err, dynamic.ErrMissingSymbol) {
+		t.Fatalf("expect ErrMissingSymbol, got %v", err)
+	}
+	if _, err := RequireAs[string](p, "sample", "Run"); !errors.Is(err, ErrNotFunction) {
+		t.Fatalf("expect ErrNotFunction, got %v", err)
+	}
+	if _, err := RequireAs[func(int, string) string](p, "sample", "Run"); !errors.Is(err, ErrSignature) {
+		t.Fatalf("expect ErrSignature, got %v", err)
+	}
+	f, err := RequireAs[func() string](p, "sample", "sample.Run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(f())
+}
+
+func TestLookupQualified(t *testing.T) {
+	p := fn.Panic1(NewPool())
+	d := dynamic.Proto(nil)
+	p.RegisterTypes(&d)
+	fn.Panic(p.LoadFile("../testdata/constant.a", "sample"))
+	if _, err := p.Lookup("sample", "constProto.Name"); err != nil {
+		t.Fatalf("method should be qualified by package: %v", err)
+	}
+	dir := t.TempDir()
+	l := dynamic.NewDynamic(make(dynamic.Symbols))
+	fn.Panic(l.InitializeMany([]string{compile(dir, "dep", depSource), compile(dir, "user", userSource)}, []string{"dep", "user"}))
+	var b bytes.Buffer
+	fn.Panic(l.Serialize(&b))
+	fn.Panic(p.LoadLinkable(&b))
+	f, err := RequireAs[func() string](p, "user", "dep.Hello")
+	if err != nil {
+		t.Fatalf("symbol of other package should be found as is: %v", err)
+	}
+	if v := f(); v != "dep" {
+		t.Fatalf("dep.Hello returns %q", v)
+	}
+}
+
+func TestOrder(t *testing.T) {
+	a := &unit{file: "a.o", provides: []string{"a"}, imports: []string{"fmt"}}
+	b := &unit{file: "b.o", provides: []string{"b"}, imports: []string{"c"}}
+	c := &unit{file: "c.linkable", provides: []string{"c", "c/internal"}, imports: []string{"a"}}
+	x := &unit{file: "x.o", provides: []string{"x"}, imports: []string{"y"}}
+	y := &unit{file: "y.o", provides: []string{"y"}, imports: []string{"x"}}
+	z := &unit{file: "z.o", provides: []string{"z"}, imports: []string{"x"}}
+	ordered, cyclic, blocked := order([]*unit{z, y, x, c, b, a})
+	if !slices.Equal(ordered, []*unit{a, c, b}) {
+		t.Fatalf("ordered %v", ordered)
+	}
+	if !slices.Equal(cyclic, []*unit{x, y}) {
+		t.Fatalf("cyclic %v", cyclic)
+	}
+	if !slices.Equal(blocked, []*unit{z}) {
+		t.Fatalf("blocked %v", blocked)
+	}
+}
+
+func TestKeyFileName(t *testing.T) {
+	k := Key{"github.com/a/b", "v1.0"}
+	name := k.FileName(".o")
+	if name != "github.com%2Fa%2Fb@v1.0.o" {
+		t.Fatalf("file name %s", name)
+	}
+	dir := t.TempDir()
+	fn.Panic(dynamic.CopyFile("../testdata/func.o", filepath.Join(dir, name), nil))
+	u := fn.Panic1(scan(filepath.Join(dir, name)))
+	if u.key != k {
+		t.Fatalf("scanned key %v", u.key)
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	p := fn.Panic1(NewPool())
+	d := dynamic.Proto(nil)
+	p.RegisterTypes(&d)
+	dir := t.TempDir()
+	fn.Panic(dynamic.CopyFile("../testdata/constant.a", filepath.Join(dir, "sample@v1.a"), nil))
+	fn.Panic(p.LoadDir(dir))
+	s := p.Require("sample@v1", "Run")
+	t.Log(dynamic.As[func() string](&s)())
+}
+
+func TestConflictPolicy(t *testing.T) {
+	for _, policy := range []dynamic.ConflictPolicy{dynamic.ConflictFirstWins, dynamic.ConflictError, dynamic.ConflictLastWins, dynamic.ConflictPrefix} {
+		t.Run(policy.String(), func(t *testing.T) {
+			p := fn.Panic1(NewPool())
+			p.SetConflictPolicy(policy)
+			fn.Panic(p.symbols.Store("other.Run", 1))
+			err := p.LoadFile("../testdata/func.o", "other")
+			if policy == dynamic.ConflictError {
+				if !errors.Is(err, dynamic.ErrConflict) || len(p.Loaded) != 0 {
+					t.Fatalf("expect rejected by ErrConflict, got %v", err)
+				}
+				return
+			}
+			fn.Panic(err)
+			if c := p.Conflicts(); len(c) != 1 || c[0].Symbol != "other.Run" || c[0].Existing != "host" {
+				t.Fatalf("conflicts %v", c)
+			}
+			u, _ := p.symbols.Lookup("other.Run")
+			switch policy {
+			case dynamic.ConflictFirstWins:
+				if u != 1 {
+					t.Fatalf("registered symbol should be kept, got %x", u)
+				}
+			case dynamic.ConflictLastWins:
+				if u == 1 {
+					t.Fatal("registered symbol should be overridden")
+				}
+				fn.Panic(p.Unload("other"))
+				if u, _ = p.symbols.Lookup("other.Run"); u != 1 {
+					t.Fatalf("overridden symbol should be restored, got %x", u)
+				}
+			case dynamic.ConflictPrefix:
+				if _, ok := p.symbols.Lookup("other:other.Run"); u != 1 || !ok {
+					t.Fatal("new symbol should be registered with prefix")
+				}
+			}
+		})
+	}
+}
+
+func TestLoadDirLayers(t *testing.T) {
+	p := fn.Panic1(NewPool())
+	d := dynamic.Proto(nil)
+	p.RegisterTypes(&d)
+	dir := t.TempDir()
+	_, layer := layered(dir)
+	fn.Panic(p.LoadDir(dir))
+	if len(p.Loaded) != 2 || p.Layers[layer] == nil || p.Layers[layer].refs != 1 {
+		t.Fatalf("layer should be loaded once by the module requires it: %+v", p.Layers)
+	}
+}
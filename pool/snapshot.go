@@ -0,0 +1,218 @@
+package pool
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+type (
+	// Snapshot is a serializable description of modules loaded in a Pool, in load order.
+	Snapshot struct {
+		Modules []ModuleState `json:"modules"`
+	}
+	// ModuleState describes a loaded module.
+	ModuleState struct {
+		File     string   `json:"file,omitempty"`     // source file, empty for linkable loaded from reader
+		Linkable bool     `json:"linkable,omitempty"` // source is a serialized linker
+		Packages []string `json:"packages"`
+		Version  string   `json:"version,omitempty"`
+		Hash     string   `json:"hash"`               // hex encoded sha256 of source content
+		Current  []string `json:"current,omitempty"`  // packages the module is current version of
+		Layer    bool     `json:"layer,omitempty"`    // loaded as a layer, File is its absolute path
+		Refs     int      `json:"refs,omitempty"`     // reference count of the layer
+		Requires []string `json:"requires,omitempty"` // files of layers the module requires
+	}
+	// Source locates the source file of a recorded module.
+	Source func(m ModuleState) (file string, err error)
+)
+
+var (
+	// ErrHashMismatch occurs when restore a module from a source with different content.
+	ErrHashMismatch = errors.New("module content hash mismatch")
+	// ErrInvalidSnapshot occurs when restore a snapshot has a module without packages or file.
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+)
+
+// Snapshot describe what is loaded in the pool.
+func (p *Pool) Snapshot() (s *Snapshot) {
+	p.RLock()
+	defer p.RUnlock()
+	s = new(Snapshot)
+	layers := make(map[*Module]string, len(p.Layers))
+	for f, l := range p.Layers {
+		layers[l] = f
+	}
+	for _, m := range p.Loaded {
+		x := ModuleState{
+			File:     m.File,
+			Linkable: m.data != nil,
+			Packages: slices.Clone(m.Packages),
+			Version:  m.Version,
+			Hash:     m.Hash,
+			Current:  p.currents(m),
+		}
+		if f, ok := layers[m]; ok {
+			x.Layer, x.File, x.Refs = true, f, m.refs
+		}
+		for _, l := range m.layers {
+			x.Requires = append(x.Requires, layers[l])
+		}
+		s.Modules = append(s.Modules, x)
+	}
+	return
+}
+
+// Restore rebuild a pool from a snapshot, types are registered before loading any module.
+//
+// The source locates the file of each module, when it's nil the recorded file is used.
+// Each file must have the same content hash as recorded. Layers are restored before modules require them, with
+// their recorded reference counts.
+func Restore(s *Snapshot, source Source, types ...any) (p *Pool, err error) {
+	if err = s.validate(source != nil); err != nil {
+		return
+	}
+	if p, err = NewPool(); err != nil {
+		return
+	}
+	p.RegisterTypes(types...)
+	defer func() {
+		if err != nil {
+			p.Free()
+			p = nil
+		}
+	}()
+	located := make(map[string]string) // recorded file of layers to the located
+	for _, m := range s.ordered() {
+		file := m.File
+		if source != nil {
+			if file, err = source(m); err != nil {
+				return
+			}
+		}
+		if err = p.restoreModule(m, file, located); err != nil {
+			err = fmt.Errorf("restore %s from %q: %w", Key{m.Packages[0], m.Version}, file, err)
+			return
+		}
+		if m.Layer {
+			located[m.File] = file
+		}
+	}
+	for _, m := range s.Modules {
+		if m.Layer {
+			if err = p.restoreRefs(located[m.File], m.Refs); err != nil {
+				return
+			}
+		}
+		for _, pkg := range m.Current {
+			if err = p.Promote(pkg, m.Version); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// validate each module has packages and a file, the file is not required when located by a Source.
+// Required layers must be recorded.
+func (s *Snapshot) validate(located bool) error {
+	layers := make(map[string]bool)
+	for _, m := range s.Modules {
+		if m.Layer {
+			layers[m.File] = true
+		}
+	}
+	for i, m := range s.Modules {
+		if len(m.Packages) == 0 {
+			return fmt.Errorf("%w: module %d has no package", ErrInvalidSnapshot, i)
+		}
+		if m.File == "" && (!located || m.Layer) {
+			return fmt.Errorf("%w: module %s has no file", ErrInvalidSnapshot, Key{m.Packages[0], m.Version})
+		}
+		for _, l := range m.Requires {
+			if !layers[l] {
+				return fmt.Errorf("%w: module %s requires unrecorded layer %s", ErrInvalidSnapshot, Key{m.Packages[0], m.Version}, l)
+			}
+		}
+	}
+	return nil
+}
+
+// ordered returns modules in load order with layers before modules require them.
+func (s *Snapshot) ordered() (v []ModuleState) {
+	done := make(map[string]bool)
+	rest := slices.Clone(s.Modules)
+	for len(rest) > 0 {
+		n := len(rest)
+		rest = slices.DeleteFunc(rest, func(m ModuleState) bool {
+			for _, l := range m.Requires {
+				if !done[l] {
+					return false
+				}
+			}
+			v = append(v, m)
+			if m.Layer {
+				done[m.File] = true
+			}
+			return true
+		})
+		if len(rest) == n {
+			// cyclic requirements, left for loading to report
+			return append(v, rest...)
+		}
+	}
+	return
+}
+
+// restoreRefs set the reference count of a restored layer.
+func (p *Pool) restoreRefs(file string, refs int) (err error) {
+	p.Lock()
+	defer p.unlock()
+	if file, err = filepath.Abs(file); err != nil {
+		return
+	}
+	l, ok := p.Layers[file]
+	if !ok {
+		return ErrNotLoad
+	}
+	l.refs = refs
+	return
+}
+
+func (p *Pool) restoreModule(m ModuleState, file string, located map[string]string) (err error) {
+	if file == "" {
+		return os.ErrNotExist
+	}
+	if !m.Linkable {
+		var h string
+		if h, err = hashFile(file); err != nil {
+			return
+		}
+		if h != m.Hash {
+			return ErrHashMismatch
+		}
+		return p.LoadFile(file, Key{m.Packages[0], m.Version}.String())
+	}
+	var b []byte
+	if b, err = os.ReadFile(file); err != nil {
+		return
+	}
+	if hash(b) != m.Hash {
+		return ErrHashMismatch
+	}
+	p.Lock()
+	defer p.unlock()
+	if m.Layer {
+		_, err = p.acquire([]string{file})
+		return
+	}
+	var layers []string
+	for _, l := range m.Requires {
+		layers = append(layers, located[l])
+	}
+	_, err = p.loadRequired(&source{Reader: bytes.NewReader(b), file: file}, []string{m.Version}, layers)
+	return
+}
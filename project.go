@@ -0,0 +1,285 @@
+package dynamic
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+type (
+	// Project declares modules to build, it's read from a json file such as 'dynamic.json'.
+	//
+	// Relative paths inside are relative to the directory of the project file.
+	Project struct {
+		Dir     string          `json:"-"`                // directory of the project file
+		OutDir  string          `json:"outDir,omitempty"` // directory of artifacts, default the directory of each module
+		Cache   *Cache          `json:"-"`                // build cache, disabled if nil
+		Modules []ProjectModule `json:"modules"`
+	}
+	// ProjectModule declares how to build a module.
+	//
+	//   - Layer: packages matched by Patterns are packed as a layer, see [Builder.PackLayer].
+	//   - Sources with PkgPath: sources are packed as the package, see [Builder.Pack].
+	//   - Sources without PkgPath: sources are compiled to an object file, see [Builder.Compile].
+	//   - Otherwise: packages of the go module in Dir matched by Patterns are packed, see [Builder.PackModule].
+	//
+	// Either Sources or Patterns is required, and names in Layers must refer to layer modules.
+	ProjectModule struct {
+		Name       string       `json:"name"`
+		Dir        string       `json:"dir,omitempty"` // directory of sources, default the project directory
+		Sources    []string     `json:"sources,omitempty"`
+		Patterns   []string     `json:"patterns,omitempty"`
+		PkgPath    string       `json:"pkg,omitempty"`
+		Layer      bool         `json:"layer,omitempty"`
+		NoPkg      bool         `json:"noPkg,omitempty"`
+		Includes   []string     `json:"includes,omitempty"`
+		Excludes   []string     `json:"excludes,omitempty"`
+		Host       string       `json:"host,omitempty"`
+		Layers     []string     `json:"layers,omitempty"` // names of layer modules in the project, or linkable files
+		Output     string       `json:"output,omitempty"` // output file, default the artifact name inside OutDir or Dir
+		Retain     string       `json:"retain,omitempty"` // directory to retain intermediate files
+		Options    BuildOptions `json:"options,omitempty"`
+		SigningKey string       `json:"signingKey,omitempty"` // PEM encoded PKCS #8 private key, signature is written as '<output>.sig'
+	}
+	// ProjectResult is the result of a module built.
+	ProjectResult struct {
+		Name   string
+		Output string
+		*BuildResult
+		Err error
+	}
+)
+
+var (
+	// ErrInvalidProject occurs when the project file declares invalid modules.
+	ErrInvalidProject = errors.New("invalid project")
+	// ErrSkipped occurs when a module is not built for a layer it requires failed.
+	ErrSkipped = errors.New("skipped")
+)
+
+// ReadProject read a project file.
+func ReadProject(file string) (p *Project, err error) {
+	var b []byte
+	if b, err = os.ReadFile(file); err != nil {
+		return
+	}
+	p = new(Project)
+	if err = json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidProject, file, err)
+	}
+	if p.Dir, err = filepath.Abs(filepath.Dir(file)); err != nil {
+		return
+	}
+	return p, p.validate()
+}
+
+func (p *Project) validate() error {
+	var names []string
+	for _, m := range p.Modules {
+		if m.Name == "" {
+			return fmt.Errorf("%w: module without name", ErrInvalidProject)
+		}
+		if slices.Contains(names, m.Name) {
+			return fmt.Errorf("%w: duplicate module %s", ErrInvalidProject, m.Name)
+		}
+		names = append(names, m.Name)
+		if len(m.Sources) == 0 && len(m.Patterns) == 0 {
+			return fmt.Errorf("%w: module %s without sources or patterns", ErrInvalidProject, m.Name)
+		}
+		if m.Layer && len(m.Patterns) == 0 {
+			return fmt.Errorf("%w: layer %s without patterns", ErrInvalidProject, m.Name)
+		}
+	}
+	for _, m := range p.Modules {
+		for _, l := range m.Layers {
+			if x := p.module(l); x != nil && !x.Layer {
+				return fmt.Errorf("%w: module %s uses %s as layer, which is not a layer", ErrInvalidProject, m.Name, l)
+			}
+		}
+	}
+	visiting := make(map[string]int)
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch visiting[name] {
+		case 1:
+			return fmt.Errorf("%w: layers cycle at %s", ErrInvalidProject, name)
+		case 2:
+			return nil
+		}
+		visiting[name] = 1
+		for _, l := range p.module(name).Layers {
+			if p.module(l) != nil {
+				if err := visit(l); err != nil {
+					return err
+				}
+			}
+		}
+		visiting[name] = 2
+		return nil
+	}
+	for _, n := range names {
+		if err := visit(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Project) module(name string) *ProjectModule {
+	for i := range p.Modules {
+		if p.Modules[i].Name == name {
+			return &p.Modules[i]
+		}
+	}
+	return nil
+}
+
+// path resolve a path relative to the project directory.
+func (p *Project) path(s string) string {
+	if s == "" || filepath.IsAbs(s) {
+		return s
+	}
+	return filepath.Join(p.Dir, s)
+}
+
+// Build modules by names, or all modules if names is empty. Modules are built in parallel, while modules require
+// layers of the project wait for them. Results are in the order of declaration.
+func (p *Project) Build(ctx context.Context, debug bool, names ...string) (v []*ProjectResult) {
+	var modules []*ProjectModule
+	for i := range p.Modules {
+		if len(names) == 0 || slices.Contains(names, p.Modules[i].Name) {
+			modules = append(modules, &p.Modules[i])
+		}
+	}
+	done := make(map[string]chan struct{}, len(p.Modules))
+	results := make(map[string]*ProjectResult, len(p.Modules))
+	for _, m := range p.Modules {
+		done[m.Name] = make(chan struct{})
+		results[m.Name] = &ProjectResult{Name: m.Name}
+	}
+	// layers of the project required by selected modules are built too
+	for i := 0; i < len(modules); i++ {
+		for _, l := range modules[i].Layers {
+			if x := p.module(l); x != nil && !slices.Contains(modules, x) {
+				modules = append(modules, x)
+			}
+		}
+	}
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	var wg sync.WaitGroup
+	for _, m := range modules {
+		wg.Add(1)
+		go func(m *ProjectModule) {
+			defer wg.Done()
+			defer close(done[m.Name])
+			r := results[m.Name]
+			for _, l := range m.Layers {
+				if _, ok := done[l]; !ok {
+					continue
+				}
+				<-done[l]
+				if results[l].Err != nil {
+					r.Err = fmt.Errorf("%w: %s requires failed layer %s", ErrSkipped, m.Name, l)
+					return
+				}
+			}
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			r.Output, r.BuildResult, r.Err = p.build(ctx, m, results, debug)
+		}(m)
+	}
+	wg.Wait()
+	for i := range p.Modules {
+		if slices.Contains(modules, &p.Modules[i]) {
+			v = append(v, results[p.Modules[i].Name])
+		}
+	}
+	return
+}
+
+// build a module then write its artifact, manifest and signature.
+func (p *Project) build(ctx context.Context, m *ProjectModule, results map[string]*ProjectResult, debug bool) (out string, r *BuildResult, err error) {
+	b := &Builder{Dir: p.path(m.Dir), Debug: debug, Options: m.Options, Retain: p.path(m.Retain), Cache: p.Cache}
+	if b.Dir == "" {
+		b.Dir = p.Dir
+	}
+	opt := PackOptions{NoPkg: m.NoPkg, Includes: m.Includes, Excludes: m.Excludes, Host: p.path(m.Host)}
+	for _, l := range m.Layers {
+		if x, ok := results[l]; ok {
+			opt.Layers = append(opt.Layers, x.Output)
+		} else {
+			opt.Layers = append(opt.Layers, p.path(l))
+		}
+	}
+	switch {
+	case m.Layer:
+		r, err = b.PackLayer(ctx, m.Name, m.Patterns, opt)
+	case len(m.Sources) > 0 && m.PkgPath != "":
+		r, err = b.Pack(ctx, m.Sources, m.PkgPath, opt)
+	case len(m.Sources) > 0:
+		r, err = b.Compile(ctx, m.Sources)
+	default:
+		r, err = b.PackModule(ctx, m.Patterns, opt)
+	}
+	if err != nil {
+		return
+	}
+	dir := b.Dir
+	if p.OutDir != "" {
+		dir = p.path(p.OutDir)
+	}
+	out = r.Output(p.path(m.Output), dir)
+	if err = r.Write(out); err != nil {
+		return
+	}
+	if m.SigningKey != "" {
+		err = Sign(p.path(m.SigningKey), out)
+	}
+	return
+}
+
+// Sign write signature of a file as '<file>.sig' by a PEM encoded PKCS #8 private key.
+// Ed25519 keys sign the content, other keys sign the sha256 digest of content.
+func Sign(key, file string) (err error) {
+	var b, data, sig []byte
+	if b, err = os.ReadFile(key); err != nil {
+		return
+	}
+	blk, _ := pem.Decode(b)
+	if blk == nil {
+		return fmt.Errorf("invalid PEM key %s", key)
+	}
+	var k any
+	if k, err = x509.ParsePKCS8PrivateKey(blk.Bytes); err != nil {
+		return
+	}
+	s, ok := k.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("unsupported key %s", key)
+	}
+	if data, err = os.ReadFile(file); err != nil {
+		return
+	}
+	if _, ok = s.(ed25519.PrivateKey); ok {
+		sig, err = s.Sign(rand.Reader, data, crypto.Hash(0))
+	} else {
+		h := sha256.Sum256(data)
+		sig, err = s.Sign(rand.Reader, h[:], crypto.SHA256)
+	}
+	if err != nil {
+		return
+	}
+	return os.WriteFile(file+".sig", sig, 0644)
+}
@@ -0,0 +1,101 @@
+package dynamic
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadProject(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "dynamic.json")
+	for s, ok := range map[string]bool{
+		`{"modules":[{"name":"a","sources":["a.go"],"layers":["b"]},{"name":"b","layer":true,"patterns":["./b"]}]}`:                             true,
+		`{"modules":[{"name":"a","patterns":["./..."],"layers":["x.linkable"]}]}`:                                                               true,
+		`{"modules":[{"name":"a","sources":["a.go"]},{"name":"a","sources":["a.go"]}]}`:                                                         false,
+		`{"modules":[{"name":"a","sources":["a.go"],"layers":["b"]},{"name":"b","sources":["b.go"]}]}`:                                          false,
+		`{"modules":[{"name":"a","sources":["a.go"]},{"name":"b","layers":["a"]}]}`:                                                             false,
+		`{"modules":[{"name":"a","sources":["a.go"],"layer":true}]}`:                                                                            false,
+		`{"modules":[{"name":"a","layer":true,"patterns":["./a"],"layers":["b"]},{"name":"b","layer":true,"patterns":["./b"],"layers":["a"]}]}`: false,
+		`{"modules":[{"name":"a"}]}`: false,
+		`{"modules":[{"dir":"a"}]}`:  false,
+	} {
+		if err := os.WriteFile(file, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+		p, err := ReadProject(file)
+		if ok != (err == nil) {
+			t.Fatal(s, err)
+		}
+		if err == nil && p.Dir != dir {
+			t.Fatal(p.Dir)
+		}
+		if !ok && !errors.Is(err, ErrInvalidProject) {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestProjectBuild(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc Hello() string { return \"hello\" }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := &Project{Dir: dir, Modules: []ProjectModule{
+		{Name: "hello", Sources: []string{"main.go"}, Output: "out/hello.o"},
+		{Name: "broken", Layer: true, Patterns: []string{"./missing"}},
+		{Name: "feature", Layers: []string{"broken"}},
+	}}
+	v := p.Build(context.Background(), false)
+	if len(v) != 3 || v[0].Name != "hello" || v[1].Name != "broken" || v[2].Name != "feature" {
+		t.Fatal(v)
+	}
+	if v[0].Err != nil {
+		t.Fatal(v[0].Err)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "out", "hello.o")); err != nil || len(b) == 0 {
+		t.Fatal(err)
+	}
+	if v[1].Err == nil || !errors.Is(v[2].Err, ErrSkipped) {
+		t.Fatal(v[1].Err, v[2].Err)
+	}
+	if v = p.Build(context.Background(), false, "feature"); len(v) != 2 || v[0].Name != "broken" {
+		t.Fatal(v)
+	}
+}
+
+func TestSign(t *testing.T) {
+	dir := t.TempDir()
+	pub, pri, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := x509.MarshalPKCS8PrivateKey(pri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := filepath.Join(dir, "key.pem")
+	if err = os.WriteFile(key, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "main.linkable")
+	if err = os.WriteFile(file, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = Sign(key, file); err != nil {
+		t.Fatal(err)
+	}
+	sig, err := os.ReadFile(file + ".sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(pub, []byte("content"), sig) {
+		t.Fatal("invalid signature")
+	}
+}
@@ -0,0 +1,104 @@
+package dynamic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// SDK is the go toolchain reported by 'go env'.
+type SDK struct {
+	GOROOT    string
+	GOVERSION string
+}
+
+// overlay is the json file of 'go build -overlay'.
+type overlay struct {
+	Replace map[string]string
+}
+
+// DetectSDK by 'go env' rather than environment variables, which may not be set.
+func DetectSDK(ctx context.Context) (s SDK, err error) {
+	var out []byte
+	if out, err = exec.CommandContext(ctx, "go", "env", "GOROOT", "GOVERSION").Output(); err != nil {
+		return s, fmt.Errorf("detect go sdk: %w", err)
+	}
+	v := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(v) != 2 || v[0] == "" {
+		return s, fmt.Errorf("detect go sdk: unexpected output %q", out)
+	}
+	return SDK{GOROOT: strings.TrimSpace(v[0]), GOVERSION: strings.TrimSpace(v[1])}, nil
+}
+
+// DefaultSDKDir returns the directory of prepared overlays under the user cache directory, such as
+// '~/.cache/dynamic/sdk', or '~/Library/Caches/dynamic/sdk' on macOS, which patch.sh also uses.
+func DefaultSDKDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "dynamic", "sdk"), nil
+}
+
+// Overlay returns the path of overlay file of the SDK inside dir.
+func (s SDK) Overlay(dir string) string {
+	return filepath.Join(dir, s.GOVERSION, "overlay.json")
+}
+
+// Legacy reports the SDK is patched in place by former versions, that 'cmd/objfile' exists inside GOROOT.
+func (s SDK) Legacy() bool {
+	_, err := os.Stat(filepath.Join(s.GOROOT, "src", "cmd", "objfile"))
+	return err == nil
+}
+
+// Prepare write an overlay file inside dir, which provides 'cmd/objfile' required by goloader as a mirror of
+// 'cmd/internal', the GOROOT is never modified. Returns the path of overlay file, use it to build the host by
+// 'go build -overlay=<file>' or 'GOFLAGS=-overlay=<file>'. The mirror directories do not exist on disk, vet of
+// 'go test' fails to enter them, test the host by 'go test -vet=off -overlay=<file>'.
+func (s SDK) Prepare(dir string) (file string, err error) {
+	src := filepath.Join(s.GOROOT, "src", "cmd", "internal")
+	dst := filepath.Join(s.GOROOT, "src", "cmd", "objfile")
+	o := overlay{Replace: make(map[string]string)}
+	if err = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == "testdata" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		o.Replace[filepath.Join(dst, rel)] = path
+		return nil
+	}); err != nil {
+		return
+	}
+	var b []byte
+	if b, err = json.MarshalIndent(o, "", "  "); err != nil {
+		return
+	}
+	file = s.Overlay(dir)
+	if err = os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return
+	}
+	return file, writeFile(file, b)
+}
+
+// Clean remove the overlay file of the SDK inside dir.
+func (s SDK) Clean(dir string) (err error) {
+	if err = os.RemoveAll(filepath.Dir(s.Overlay(dir))); errors.Is(err, fs.ErrNotExist) {
+		err = nil
+	}
+	return
+}
@@ -0,0 +1,42 @@
+package dynamic
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSDKPrepare(t *testing.T) {
+	s, err := DetectSDK(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	file, err := s.Prepare(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file != s.Overlay(dir) {
+		t.Fatal(file)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var o overlay
+	if err = json.Unmarshal(b, &o); err != nil {
+		t.Fatal(err)
+	}
+	objabi := filepath.Join(s.GOROOT, "src", "cmd", "objfile", "objabi", "reloctype.go")
+	if o.Replace[objabi] != filepath.Join(s.GOROOT, "src", "cmd", "internal", "objabi", "reloctype.go") {
+		t.Fatal(o.Replace[objabi])
+	}
+	if err = s.Clean(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(file); !os.IsNotExist(err) {
+		t.Fatal("overlay should be removed")
+	}
+}
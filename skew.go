@@ -0,0 +1,90 @@
+package dynamic
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"slices"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// Skew is a package imported by a module built against a version different from the host.
+type Skew struct {
+	PkgPath string
+	Module  string // module path provides the package in the host
+	Version string // version the module built against
+	Host    string // version of the module in the host
+}
+
+// ErrVersionSkew occurs when a module built against dependencies of versions different from the host.
+var ErrVersionSkew = errors.New("version skew")
+
+func (s Skew) String() string {
+	return fmt.Sprintf("%s built against %s@%s but host has %s", s.PkgPath, s.Module, s.Version, s.Host)
+}
+
+// CheckSkew compare versions of imports against modules in build info of the host. Imports without version,
+// or provided by modules not in the host, or by the main module of host, or by modules replaced with a local path
+// in the host are ignored. Versions are compared by semantic version, build metadata such as +incompatible
+// is ignored.
+func CheckSkew(host *debug.BuildInfo, infos ...*Info) (v []Skew) {
+	mods := make(map[string]string, len(host.Deps))
+	for _, m := range host.Deps {
+		if m.Replace != nil {
+			mods[m.Path] = m.Replace.Version // empty for a path replace
+		} else {
+			mods[m.Path] = m.Version
+		}
+	}
+	for _, info := range infos {
+		for p, ver := range info.Imports {
+			if ver == "" {
+				continue
+			}
+			var mod string
+			for m := range mods {
+				if (p == m || strings.HasPrefix(p, m+"/")) && len(m) > len(mod) {
+					mod = m
+				}
+			}
+			if mod != "" && mods[mod] != "" && !sameVersion(mods[mod], ver) {
+				v = append(v, Skew{PkgPath: p, Module: mod, Version: ver, Host: mods[mod]})
+			}
+		}
+	}
+	slices.SortFunc(v, func(a, b Skew) int {
+		return strings.Compare(a.PkgPath, b.PkgPath)
+	})
+	return slices.Compact(v)
+}
+
+// sameVersion compare two versions by semantic version if both valid.
+func sameVersion(a, b string) bool {
+	if semver.IsValid(a) && semver.IsValid(b) {
+		return semver.Compare(a, b) == 0
+	}
+	return a == b
+}
+
+// SkewError returns an error joins all skews as ErrVersionSkew, nil if empty.
+func SkewError(skews []Skew) error {
+	var errs []error
+	for _, s := range skews {
+		errs = append(errs, fmt.Errorf("%w: %s", ErrVersionSkew, s))
+	}
+	return errors.Join(errs...)
+}
+
+// CheckSkew compare versions of imports of an initialized Dynamic against the running executable.
+func (s *Dynamic) CheckSkew() []Skew {
+	if s.linker == nil {
+		panic(ErrUninitialized)
+	}
+	host, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil
+	}
+	return CheckSkew(host, LinkerImportsIter(s.linker)...)
+}
@@ -0,0 +1,32 @@
+package dynamic
+
+import (
+	"errors"
+	"runtime/debug"
+	"testing"
+)
+
+func TestCheckSkew(t *testing.T) {
+	host := &debug.BuildInfo{Deps: []*debug.Module{
+		{Path: "github.com/ZenLiuCN/fn", Version: "v0.1.40"},
+		{Path: "github.com/a/b", Version: "v1.0.0"},
+		{Path: "github.com/a/b/v2", Version: "v2.0.0", Replace: &debug.Module{Path: "../b", Version: "v2.1.0"}},
+		{Path: "github.com/p/q", Version: "v1.0.0", Replace: &debug.Module{Path: "../q"}},
+		{Path: "github.com/i/j", Version: "v3.0.0+incompatible"},
+	}}
+	v := CheckSkew(host, &Info{Imports: map[string]string{
+		"github.com/ZenLiuCN/fn":  "v0.1.35",
+		"github.com/a/b/c":        "v1.0.0",
+		"github.com/a/b/v2/d":     "v2.0.0",
+		"github.com/x/y":          "v0.0.1",
+		"github.com/a/b/internal": "",
+		"github.com/p/q/r":        "v1.2.0",
+		"github.com/i/j":          "v3.0.0",
+	}})
+	if len(v) != 2 || v[0].Module != "github.com/ZenLiuCN/fn" || v[1].Module != "github.com/a/b/v2" || v[1].Host != "v2.1.0" {
+		t.Fatal(v)
+	}
+	if err := SkewError(v); !errors.Is(err, ErrVersionSkew) {
+		t.Fatal(err)
+	}
+}
@@ -2,6 +2,8 @@ package dynamic
 
 import (
 	"errors"
+	"maps"
+	"sync"
 
 	"github.com/pkujhd/goloader"
 )
@@ -15,10 +17,303 @@ var (
 	ErrLinked = errors.New("already linked")
 	// ErrUninitialized occurs use or link a Dynamic before initialized.
 	ErrUninitialized = errors.New("module not initialized")
+	// ErrImmutableSymbols occurs when modify the host symbols.
+	ErrImmutableSymbols = errors.New("immutable symbols")
 )
 
+type (
+	// Symbols contains resolved symbols.
+	//
+	// If two Dynamic shares the same Symbols instance, it may depend on each other after make.
+	Symbols map[string]uintptr
+	// SymbolLayer is a layered table of resolved symbols, it's safe for concurrent use.
+	//
+	// Each layer only holds its own additions and resolves others through its parent, the bottom layer is
+	// the immutable symbols of the host executable, see [HostSymbols]. A layer is created by [SymbolLayer.Fork],
+	// additions to it never leak into its parent.
+	//
+	// Dynamic linked on a layer shares one flattened table of the layer, it's built on first link then kept up to
+	// date by changes of the layer, and only rebuilt after a parent changed.
+	SymbolLayer struct {
+		parent *SymbolLayer
+		mu     sync.RWMutex
+		own    map[string]uintptr
+		flat   map[string]uintptr // flattened table for linking, nil before first link
+		base   uint64             // revision of parents the flat table built on
+		rev    uint64             // revision of own symbols
+		frozen bool
+	}
+	// SymbolTable is a mutable table of symbols, Symbols and SymbolLayer are the standard implementations.
+	SymbolTable interface {
+		Lookup(name string) (uintptr, bool)
+		Store(name string, addr uintptr) error
+		Remove(name string) error
+	}
+	// SymbolSource provides the layer to link a Dynamic on.
+	SymbolSource interface {
+		Layer() *SymbolLayer
+	}
+)
+
+// NewSymbols create a Symbols contains symbols of the host executable.
+//
+// Deprecated: it copies all host symbols, use [NewSymbolLayer] instead.
 func NewSymbols() (t Symbols, err error) {
-	t = make(map[string]uintptr)
-	err = goloader.RegSymbol(t)
+	var h *SymbolLayer
+	if h, err = HostSymbols(); err != nil {
+		return
+	}
+	return h.Map(), nil
+}
+
+// ExistsSymbols returns names of all symbols.
+func (s Symbols) ExistsSymbols() (v []string) {
+	for x := range maps.Keys(s) {
+		v = append(v, x)
+	}
+	return
+}
+
+// Lookup a symbol.
+func (s Symbols) Lookup(name string) (u uintptr, ok bool) {
+	u, ok = s[name]
+	return
+}
+
+// Store a symbol.
+func (s Symbols) Store(name string, addr uintptr) error {
+	s[name] = addr
+	return nil
+}
+
+// Remove a symbol.
+func (s Symbols) Remove(name string) error {
+	delete(s, name)
+	return nil
+}
+
+// RegisterTypes register symbols of types, such as pointers to interfaces, which modules import from the host.
+func (s Symbols) RegisterTypes(types ...any) {
+	goloader.RegTypes(s, types...)
+}
+
+// Layer returns a bottom layer operates on the Symbols directly, changes made by linking remain in the Symbols.
+func (s Symbols) Layer() *SymbolLayer {
+	return &SymbolLayer{own: s}
+}
+
+// NewSymbolLayer create a new layer on the host symbols.
+func NewSymbolLayer() (t *SymbolLayer, err error) {
+	if t, err = HostSymbols(); err != nil {
+		return
+	}
+	return t.Fork(), nil
+}
+
+// Layer returns the layer itself.
+func (s *SymbolLayer) Layer() *SymbolLayer {
+	return s
+}
+
+// Fork create a new layer on the layer.
+func (s *SymbolLayer) Fork() *SymbolLayer {
+	return &SymbolLayer{parent: s, own: make(map[string]uintptr)}
+}
+
+// Parent returns the parent layer, nil for the bottom.
+func (s *SymbolLayer) Parent() *SymbolLayer {
+	return s.parent
+}
+
+// Lookup a symbol through layers.
+func (s *SymbolLayer) Lookup(name string) (u uintptr, ok bool) {
+	for x := s; x != nil; x = x.parent {
+		x.mu.RLock()
+		u, ok = x.own[name]
+		x.mu.RUnlock()
+		if ok {
+			return
+		}
+	}
+	return
+}
+
+// Store a symbol into this layer, it fails with ErrImmutableSymbols on the host symbols.
+func (s *SymbolLayer) Store(name string, addr uintptr) error {
+	if s.frozen {
+		return ErrImmutableSymbols
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.own[name] = addr
+	if s.flat != nil {
+		s.flat[name] = addr
+	}
+	s.rev++
+	return nil
+}
+
+// Remove a symbol from this layer, symbols of parents are not affected. It fails with ErrImmutableSymbols on the
+// host symbols.
+func (s *SymbolLayer) Remove(name string) error {
+	if s.frozen {
+		return ErrImmutableSymbols
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.own, name)
+	if s.flat != nil {
+		if u, ok := s.parent.Lookup(name); ok {
+			s.flat[name] = u
+		} else {
+			delete(s.flat, name)
+		}
+	}
+	s.rev++
+	return nil
+}
+
+// Update this layer by a function fills a map of symbols to add, such as functions of goloader to register symbols.
+// Symbols filled are added even f returns an error. It fails with ErrImmutableSymbols on the host symbols.
+func (s *SymbolLayer) Update(f func(own map[string]uintptr) error) (err error) {
+	if s.frozen {
+		return ErrImmutableSymbols
+	}
+	m := make(map[string]uintptr)
+	err = f(m)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	maps.Copy(s.own, m)
+	if s.flat != nil {
+		maps.Copy(s.flat, m)
+	}
+	s.rev++
+	return
+}
+
+// Map flatten all layers into a new map.
+func (s *SymbolLayer) Map() (m map[string]uintptr) {
+	var layers []*SymbolLayer
+	for x := s; x != nil; x = x.parent {
+		layers = append(layers, x)
+	}
+	for i := len(layers) - 1; i >= 0; i-- {
+		x := layers[i]
+		x.mu.RLock()
+		if m == nil {
+			m = maps.Clone(x.own)
+		} else {
+			maps.Copy(m, x.own)
+		}
+		x.mu.RUnlock()
+	}
+	return
+}
+
+// ExistsSymbols returns names of all symbols through layers.
+func (s *SymbolLayer) ExistsSymbols() (v []string) {
+	for x := range maps.Keys(s.Map()) {
+		v = append(v, x)
+	}
+	return
+}
+
+// revision of the layer and its parents.
+func (s *SymbolLayer) revision() (r uint64) {
+	for x := s; x != nil; x = x.parent {
+		x.mu.RLock()
+		r += x.rev
+		x.mu.RUnlock()
+	}
+	return
+}
+
+// flatten returns the flattened table of the layer, must hold the write lock.
+func (s *SymbolLayer) flatten() map[string]uintptr {
+	switch {
+	case s.parent == nil && !s.frozen:
+		s.flat = s.own
+	case s.parent == nil:
+		if s.flat == nil {
+			s.flat = maps.Clone(s.own)
+		}
+	default:
+		if r := s.parent.revision(); s.flat == nil || s.base != r {
+			s.flat = s.parent.Map()
+			maps.Copy(s.flat, s.own)
+			s.base = r
+		}
+	}
+	return s.flat
+}
+
+// link run f on the flattened table of the layer with own symbols added and hidden symbols removed, such as
+// functions of goloader to link. The table is restored after f returned, symbols removed by f are returned.
+func (s *SymbolLayer) link(own map[string]uintptr, hidden map[string]struct{}, f func(symPtr map[string]uintptr) error) (removed []string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	flat := s.flatten()
+	type entry struct {
+		addr uintptr
+		ok   bool
+	}
+	saved := make(map[string]entry, len(own)+len(hidden))
+	save := func(name string) {
+		if _, ok := saved[name]; !ok {
+			u, ok := flat[name]
+			saved[name] = entry{u, ok}
+		}
+	}
+	for name, u := range own {
+		save(name)
+		flat[name] = u
+	}
+	for name := range hidden {
+		save(name)
+		delete(flat, name)
+	}
+	n := len(flat)
+	err = f(flat)
+	if len(flat) < n {
+		gone := make(map[string]struct{})
+		check := func(m map[string]uintptr) {
+			for name := range m {
+				if _, ok := flat[name]; ok {
+					continue
+				}
+				if _, ok := hidden[name]; ok {
+					continue
+				}
+				if _, ok := gone[name]; !ok {
+					gone[name] = struct{}{}
+					removed = append(removed, name)
+				}
+			}
+		}
+		check(own)
+		check(s.own)
+		for x := s.parent; x != nil; x = x.parent {
+			x.mu.RLock()
+			check(x.own)
+			x.mu.RUnlock()
+		}
+	}
+	for name, e := range saved {
+		if e.ok {
+			flat[name] = e.addr
+		} else {
+			delete(flat, name)
+		}
+	}
+	for _, name := range removed {
+		if _, ok := saved[name]; ok {
+			continue
+		}
+		if u, ok := s.own[name]; ok {
+			flat[name] = u
+		} else if u, ok = s.parent.Lookup(name); ok {
+			flat[name] = u
+		}
+	}
 	return
 }
@@ -0,0 +1,71 @@
+package dynamic
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSymbolsLayers(t *testing.T) {
+	base := &SymbolLayer{own: map[string]uintptr{"a.Run": 1}, frozen: true}
+	l1 := base.Fork()
+	l2 := l1.Fork()
+	_ = l1.Store("b.Run", 2)
+	_ = l2.Store("a.Run", 3)
+	if u, _ := l2.Lookup("a.Run"); u != 3 {
+		t.Fatalf("a.Run of l2 should be overridden, got %d", u)
+	}
+	if u, _ := l1.Lookup("a.Run"); u != 1 {
+		t.Fatalf("a.Run of l1 should be inherited, got %d", u)
+	}
+	if u, ok := l2.Lookup("b.Run"); !ok || u != 2 {
+		t.Fatalf("b.Run of l2 should be inherited, got %d", u)
+	}
+	_ = l2.Remove("a.Run")
+	if u, _ := l2.Lookup("a.Run"); u != 1 {
+		t.Fatalf("a.Run of l2 should be restored, got %d", u)
+	}
+	if m := base.Map(); len(m) != 1 {
+		t.Fatalf("additions leaked into base: %v", m)
+	}
+	if err := base.Store("c.Run", 4); !errors.Is(err, ErrImmutableSymbols) {
+		t.Fatalf("base should be immutable, got %v", err)
+	}
+}
+
+func TestSymbolsLink(t *testing.T) {
+	base := &SymbolLayer{own: map[string]uintptr{"a.Run": 1, "a.init.0": 2}, frozen: true}
+	l := base.Fork()
+	_ = l.Store("b.Run", 3)
+	own := map[string]uintptr{"type:c.T": 4}
+	hidden := map[string]struct{}{}
+	removed, _ := l.link(own, hidden, func(symPtr map[string]uintptr) error {
+		if len(symPtr) != 4 {
+			t.Fatalf("symbols for linking %v", symPtr)
+		}
+		delete(symPtr, "a.init.0")
+		return nil
+	})
+	if len(removed) != 1 || removed[0] != "a.init.0" {
+		t.Fatalf("removed %v", removed)
+	}
+	hidden["a.init.0"] = struct{}{}
+	_, _ = l.link(own, hidden, func(symPtr map[string]uintptr) error {
+		if _, ok := symPtr["a.init.0"]; ok {
+			t.Fatal("removed symbol should be hidden")
+		}
+		return nil
+	})
+	flat := l.flat
+	if len(flat) != 3 || flat["a.init.0"] != 2 || flat["type:c.T"] != 0 {
+		t.Fatalf("flattened symbols not restored: %v", flat)
+	}
+	child := l.Fork()
+	child.flatten()
+	_ = l.Store("b.Do", 5)
+	if flat["b.Do"] != 5 {
+		t.Fatalf("flattened symbols not updated: %v", flat)
+	}
+	if m := child.flatten(); m["b.Do"] != 5 {
+		t.Fatalf("flattened symbols of child not rebuilt: %v", m)
+	}
+}
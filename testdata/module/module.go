@@ -0,0 +1,7 @@
+package module
+
+import "example.com/module/sub"
+
+func Run() string {
+	return sub.Upper("module")
+}
@@ -1,20 +1,16 @@
 package dynamic
 
 import (
-	"bufio"
-	"bytes"
-	"errors"
+	"context"
 	"fmt"
 	"github.com/ZenLiuCN/fn"
 	"github.com/pkujhd/goloader"
 	"github.com/pkujhd/goloader/obj"
-	"slices"
 
 	"io"
 	"io/fs"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 )
@@ -79,24 +75,28 @@ func CopyDir(src string, dest string, si fs.FileInfo) (err error) {
 
 }
 
-// Compile an object file output to working directory
+// Compile an object file output to working directory. The importcfg is generated for each build, an importcfg
+// generated by [Imports] is not used nor removed, remove has no effect.
+//
+// Deprecated: use [Builder.Compile] instead.
 func Compile(debug bool, o []string, remove bool) (err error) {
-	var cmd *exec.Cmd
-	if len(o) == 1 {
-		cmd = exec.Command("go", "tool", "compile", "-importcfg", "importcfg", o[0])
-	} else {
-		cmd = exec.Command("go", append([]string{"tool", "compile", "-importcfg", "importcfg", "-pack"}, o...)...)
+	var r *BuildResult
+	r, err = (&Builder{Debug: debug}).Compile(context.Background(), o)
+	report(r)
+	if err != nil {
+		return
 	}
-	if debug {
-		log.Printf("execute: %v", cmd.Args)
+	return os.WriteFile(r.Name, r.Data, 0644)
+}
+
+// report print diagnostics to stderr.
+func report(r *BuildResult) {
+	if r == nil {
+		return
 	}
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err = cmd.Run()
-	if err == nil && remove {
-		err = os.Remove("importcfg")
+	for _, d := range r.Diagnostics {
+		_, _ = fmt.Fprintln(os.Stderr, d)
 	}
-	return
 }
 
 var (
@@ -164,146 +164,43 @@ func checkAll(p string) bool {
 func check(p string, pkg string) bool {
 	return strings.HasPrefix(p, pkg+"/") || p == pkg
 }
+
+// Packs compile sources and pack with dependencies into a linkable output next to the first source. The importcfg
+// is generated for each build, an importcfg generated by [Imports] is not used nor removed.
+//
+// Deprecated: use [Builder.Pack] instead.
 func Packs(dbg bool, sources []string, pkgPath string, noPkg bool, includes []string, excludes []string) (err error) {
-	defer func() {
-		if err == nil && !dbg {
-			err = os.Remove("importcfg")
-		}
-	}()
-	err = Compile(dbg, sources, false)
-	if err != nil {
-		return
-	}
-	var ic, ec bool
-	var b []byte
-	var s *bufio.Scanner
-	var d map[string]string
-	if noPkg {
-		goto skipScan
-	}
-	ic = len(includes) != 0
-	ec = len(excludes) != 0
-	b = fn.Panic1(os.ReadFile("importcfg"))
-	s = bufio.NewScanner(bytes.NewReader(b))
-	s.Split(bufio.ScanLines)
-	d = make(map[string]string)
-	for s.Scan() {
-		t := s.Bytes()
-		t = bytes.TrimPrefix(t, pkgPrefix)
-		i := bytes.IndexByte(t, '=')
-		pkg := t[:i]
-		if len(pkg) > len(vendorPrefix) && bytes.Equal(pkg[:7], vendorPrefix) {
-			continue
-		}
-		p := string(pkg)
-		if checkAll(p) {
-			continue
-		}
-		if ic && slices.IndexFunc(includes, func(s string) bool {
-			return s == p || strings.HasPrefix(p, s)
-		}) >= 0 {
-			d[p] = string(t[i+1:])
-		} else if !ic && ec && slices.IndexFunc(excludes, func(s string) bool {
-			return s == p || strings.HasPrefix(p, s)
-		}) < 0 {
-			d[p] = string(t[i+1:])
-		}
-	}
-skipScan:
-	px := strings.TrimSuffix(sources[0], ".go")
-	n := px
-	if len(sources) > 1 {
-		n += ".a"
-	} else {
-		n += ".o"
-	}
-	var ss Symbols
-	ss, err = NewSymbols()
-	if err != nil {
-		return
-	}
-	l := NewDynamic(ss)
-	err = l.Initialize(n, pkgPath)
+	var r *BuildResult
+	r, err = (&Builder{Debug: dbg}).Pack(context.Background(), sources, pkgPath, PackOptions{
+		NoPkg:    noPkg,
+		Includes: includes,
+		Excludes: excludes,
+	})
+	report(r)
 	if err != nil {
 		return
 	}
 	if dbg {
-		for _, s2 := range l.MissingSymbols() {
-			log.Printf("required %s", s2)
+		for _, s := range r.Missing {
+			log.Printf("required %s", s)
 		}
 	}
-	if noPkg {
-		goto skipPkg
-	}
-	for pkg, file := range d {
-		if dbg {
-			log.Printf("will pack with %s from %s", pkg, file)
-		}
-		err = l.LoadDependencies(Dependency{
-			File:    file,
-			PkgPath: pkg,
-			Symbols: nil,
-		})
-		if err != nil {
-			return errors.Join(fmt.Errorf("loading dependecy %s from %s", pkg, file), err)
-		}
-	}
-skipPkg:
-	var o *os.File
-	o, err = os.OpenFile(px+".linkable", os.O_CREATE|os.O_TRUNC, os.ModePerm)
-	if err != nil {
-		return
-	}
-	defer fn.IgnoreClose(o)
-	err = l.Serialize(o)
-	if err != nil {
-		return
-	}
-	if !dbg {
-		err = os.Remove(n)
-	}
-	return
+	return os.WriteFile(strings.TrimSuffix(sources[0], ".go")+".linkable", r.Data, 0644)
 }
 
 // Imports generate import cfg as importcfg file in current working directory.
 func Imports(debug bool, f []string) (err error) {
-	if debug {
-		log.Printf("sources: %v", f)
-	}
-	var cfg *os.File
-	if cfg, err = os.OpenFile("importcfg", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.ModePerm); err != nil {
+	r := new(BuildResult)
+	var cfg []byte
+	cfg, err = (&Builder{Debug: debug}).importcfg(context.Background(), r, f)
+	report(r)
+	if err != nil {
 		return
 	}
-	defer fn.IgnoreClose(cfg)
-	cmd := exec.Command("go", append([]string{"list", "-export", "-f", "{{.Imports}}"}, f...)...)
-	if debug {
-		log.Printf("execute: %v", cmd.Args)
-	}
-	var out string
-	var bout []byte
-	if bout, err = cmd.Output(); err != nil {
-		return fmt.Errorf("inpsect Imports: %w\nerr:%s\nout:%s", err, err.(*exec.ExitError).Stderr, string(bout))
-	}
-	out = strings.TrimSpace(string(bout))
-	if out != "" && out[0] == '[' {
-		out = out[1 : len(out)-1]
-	}
-	in := strings.Split(out, " ")
 	if debug {
-		fmt.Println("deps", in)
+		fmt.Println("importcfg", string(cfg))
 	}
-	cmd = exec.Command("go", append([]string{"list", "-export", "-f", "{{if .Export}}packagefile {{.ImportPath}}={{.Export}}{{end}}", "std"}, in...)...)
-	if debug {
-		log.Printf("execute: %v", cmd.Args)
-	}
-	if bout, err = cmd.Output(); err != nil {
-		return fmt.Errorf("inpsect dependecies: %w\nerr:%s\nout:%s", err, err.(*exec.ExitError).Stderr, string(bout))
-	}
-	if debug {
-		fmt.Println("importcfg", string(bout))
-	}
-	_, err = cfg.Write(bout)
-	return
+	return os.WriteFile("importcfg", cfg, 0644)
 }
 
 // ObjectImportsIter resolve all imported packages and version (only if it's a module).
@@ -0,0 +1,79 @@
+package dynamic
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Watch invoke build once, then again whenever go sources, go.mod or go.sum under dir changed, until ctx is done.
+//
+// Changes are detected by polling modification time and size every interval, default 500ms. A build starts after
+// files stay unchanged for one interval, hidden directories, testdata and vendor are not watched.
+func Watch(ctx context.Context, dir string, interval time.Duration, build func(ctx context.Context)) error {
+	if interval <= 0 {
+		interval = 500 * time.Millisecond
+	}
+	last, err := fingerprint(dir)
+	if err != nil {
+		return err
+	}
+	build(ctx)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	var pending string
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+		var f string
+		if f, err = fingerprint(dir); err != nil {
+			return err
+		}
+		switch {
+		case f != pending:
+			pending = f
+		case f != last:
+			last = f
+			build(ctx)
+		}
+	}
+}
+
+// fingerprint of watched files under dir.
+func fingerprint(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil // removed while walking
+		} else if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != dir && (strings.HasPrefix(name, ".") || name == "testdata" || name == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") && name != "go.mod" && name != "go.sum" {
+			return nil
+		}
+		i, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(h, "%s:%d:%d;", path, i.Size(), i.ModTime().UnixNano())
+		return nil
+	})
+	return string(h.Sum(nil)), err
+}
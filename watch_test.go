@@ -0,0 +1,47 @@
+package dynamic
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(src, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	builds := make(chan struct{}, 8)
+	done := make(chan error)
+	go func() {
+		done <- Watch(ctx, dir, 10*time.Millisecond, func(ctx context.Context) {
+			builds <- struct{}{}
+		})
+	}()
+	<-builds
+	// not watched
+	if err := os.WriteFile(filepath.Join(dir, "main.linkable"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(builds) != 0 {
+		t.Fatal("should not rebuild")
+	}
+	if err := os.WriteFile(src, []byte("package main\n\nvar X = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-builds:
+	case <-ctx.Done():
+		t.Fatal("should rebuild")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}